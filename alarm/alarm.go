@@ -0,0 +1,142 @@
+package alarm
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/errno"
+	"github.com/chenxinqun/ginWarpPkg/loggerx"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultWindow 同一个标题的告警, 默认 1 分钟内只发送一次
+	DefaultWindow = time.Minute
+	// DefaultMaxPerMinute 默认每分钟最多发送 20 条告警
+	DefaultMaxPerMinute = 20
+)
+
+// Sender 告警发送, 可以直接用作 httpClient.AlarmObject 和 mux.AlarmSender
+type Sender interface {
+	Send(subject, body string) error
+}
+
+// SenderFunc 函数形式的 Sender
+type SenderFunc func(subject, body string) error
+
+func (f SenderFunc) Send(subject, body string) error {
+	return f(subject, body)
+}
+
+// Multi 同时发送给多个 Sender
+func Multi(senders ...Sender) Sender {
+	return SenderFunc(func(subject, body string) (err error) {
+		for _, s := range senders {
+			multierr.AppendInto(&err, s.Send(subject, body))
+		}
+		return
+	})
+}
+
+// ThrottleConfig 告警去重和限流配置, 不填时使用默认值
+type ThrottleConfig struct {
+	// Window 同一个标题的告警, 窗口内只发送第一条, 之后的在窗口结束时汇总发送一条
+	Window time.Duration `toml:"window" json:"window"`
+	// MaxPerMinute 每分钟最多发送的告警数, 超过的丢弃
+	MaxPerMinute int `toml:"maxPerMinute" json:"maxPerMinute"`
+}
+
+type pending struct {
+	count    int
+	lastBody string
+}
+
+// Throttle 在 Sender 之前做去重, 汇总和限流, 避免故障期间告警刷屏
+type Throttle struct {
+	sender Sender
+	cfg    ThrottleConfig
+
+	mu          sync.Mutex
+	titles      map[string]*pending
+	minuteStart time.Time
+	sent        int
+	dropped     int
+}
+
+func NewThrottle(sender Sender, cfg ThrottleConfig) *Throttle {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultWindow
+	}
+	if cfg.MaxPerMinute <= 0 {
+		cfg.MaxPerMinute = DefaultMaxPerMinute
+	}
+	return &Throttle{
+		sender: sender,
+		cfg:    cfg,
+		titles: make(map[string]*pending),
+	}
+}
+
+// Send 窗口内第一次出现的标题立即发送, 重复的只计数
+func (t *Throttle) Send(subject, body string) error {
+	t.mu.Lock()
+	if p, ok := t.titles[subject]; ok {
+		p.count++
+		p.lastBody = body
+		t.mu.Unlock()
+		return nil
+	}
+	t.titles[subject] = new(pending)
+	t.mu.Unlock()
+
+	time.AfterFunc(t.cfg.Window, func() {
+		t.flush(subject)
+	})
+	return t.send(subject, body)
+}
+
+// flush 窗口结束, 汇总发送窗口内重复的告警
+func (t *Throttle) flush(subject string) {
+	t.mu.Lock()
+	p := t.titles[subject]
+	delete(t.titles, subject)
+	t.mu.Unlock()
+
+	if p == nil || p.count == 0 {
+		return
+	}
+	summary := fmt.Sprintf("%s (最近 %s 内重复 %d 次)", subject, t.cfg.Window, p.count)
+	if err := t.send(summary, p.lastBody); err != nil && loggerx.Default() != nil {
+		loggerx.Default().Error("发送告警汇总失败", zap.String("subject", subject), zap.Error(err))
+	}
+}
+
+// send 每分钟最多发送 MaxPerMinute 条
+func (t *Throttle) send(subject, body string) error {
+	t.mu.Lock()
+	now := time.Now()
+	if now.Sub(t.minuteStart) >= time.Minute {
+		if t.dropped > 0 && loggerx.Default() != nil {
+			loggerx.Default().Warn("告警超过限流被丢弃", zap.Int("dropped", t.dropped))
+		}
+		t.minuteStart, t.sent, t.dropped = now, 0, 0
+	}
+	if t.sent >= t.cfg.MaxPerMinute {
+		t.dropped++
+		t.mu.Unlock()
+		return errno.Errorf("alarm rate limited, subject: %s", subject)
+	}
+	t.sent++
+	t.mu.Unlock()
+
+	return t.sender.Send(subject, body)
+}
+
+// toMarkdown 告警内容中 onFailedAlarm 使用的 <br/> 换行转换为 markdown 换行
+func toMarkdown(body string) string {
+	return strings.ReplaceAll(body, "<br/>", "\n")
+}
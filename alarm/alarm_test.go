@@ -0,0 +1,98 @@
+package alarm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+type recorder struct {
+	mu       sync.Mutex
+	subjects []string
+}
+
+func (r *recorder) Send(subject, _ string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subjects = append(r.subjects, subject)
+	return nil
+}
+
+func (r *recorder) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.subjects...)
+}
+
+func TestThrottle(t *testing.T) {
+	rec := new(recorder)
+	th := NewThrottle(rec, ThrottleConfig{Window: 50 * time.Millisecond, MaxPerMinute: 3})
+
+	for i := 0; i < 5; i++ {
+		if err := th.Send("db down", "body"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := rec.list(); len(got) != 1 {
+		t.Fatalf("duplicate alarms should be suppressed, got %v", got)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	got := rec.list()
+	if len(got) != 2 || got[1] != "db down (最近 50ms 内重复 4 次)" {
+		t.Fatalf("summary not sent, got %v", got)
+	}
+
+	if err := th.Send("cache down", "body"); err != nil {
+		t.Fatal(err)
+	}
+	if err := th.Send("mq down", "body"); err == nil {
+		t.Fatal("alarm over MaxPerMinute should be dropped")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"0123456789", 10, "0123456789"},
+		{"0123456789abc", 10, "012345" + truncatedSuffix},
+		{"告警告警", 10, "告警" + truncatedSuffix},
+		{"abc", 2, truncatedSuffix},
+	}
+	for _, c := range cases {
+		if got := truncate(c.in, c.max); got != c.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", c.in, c.max, got, c.want)
+		}
+	}
+}
+
+func TestWeComTruncate(t *testing.T) {
+	var content string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := struct {
+			Markdown struct {
+				Content string `json:"content"`
+			} `json:"markdown"`
+		}{}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		content = payload.Markdown.Content
+		_, _ = w.Write([]byte(`{"errcode":0}`))
+	}))
+	defer srv.Close()
+
+	if err := NewWeCom(srv.URL).Send("panic", strings.Repeat("堆栈<br/>", 2000)); err != nil {
+		t.Fatal(err)
+	}
+	if len(content) > MaxWeComBytes || !utf8.ValidString(content) || !strings.HasSuffix(content, truncatedSuffix) {
+		t.Errorf("content not truncated: %d bytes", len(content))
+	}
+}
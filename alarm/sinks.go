@@ -0,0 +1,144 @@
+package alarm
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chenxinqun/ginWarpPkg/errno"
+	"github.com/chenxinqun/ginWarpPkg/httpx/httpClient"
+	"github.com/chenxinqun/ginWarpPkg/mail"
+)
+
+const (
+	// DefaultTTL 发送告警的请求超时时间
+	DefaultTTL = 10 * time.Second
+
+	// 各机器人单条消息内容的长度上限, 单位字节, 超过时截断, 否则整条告警会被拒绝
+	MaxWeComBytes    = 4096
+	MaxDingTalkBytes = 20000
+	MaxFeishuBytes   = 18000
+
+	truncatedSuffix = "\n..."
+)
+
+// truncate 按字节截断内容, 不会截断半个 utf-8 字符, 截断时以 truncatedSuffix 结尾
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	n := max - len(truncatedSuffix)
+	if n < 0 {
+		n = 0
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + truncatedSuffix
+}
+
+// NewMail 通过邮件发送告警, Options 中的 Subject 和 Body 会被告警内容替换
+func NewMail(o mail.Options) Sender {
+	return SenderFunc(func(subject, body string) error {
+		opt := o
+		opt.Subject = subject
+		opt.Body = body
+		return mail.Send(&opt)
+	})
+}
+
+// NewWebhook 通用的 webhook, 以 {"subject": "", "body": ""} 的格式 POST 给 webhook 地址
+func NewWebhook(webhook string, header map[string]string) Sender {
+	return SenderFunc(func(subject, body string) error {
+		options := []httpClient.OptionHandler{httpClient.WithTTL(DefaultTTL)}
+		for k, v := range header {
+			options = append(options, httpClient.WithHeader(k, v))
+		}
+		_, err := httpClient.Post[[]byte](webhook, map[string]string{
+			"subject": subject,
+			"body":    body,
+		}, options...)
+		return err
+	})
+}
+
+// botReply 机器人接口的返回值, 钉钉和企业微信使用 errcode, 飞书使用 code
+type botReply struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+	Code    int    `json:"code"`
+	Msg     string `json:"msg"`
+}
+
+func postBot(webhook string, payload interface{}) error {
+	reply, err := httpClient.Post[botReply](webhook, payload, httpClient.WithTTL(DefaultTTL))
+	if err != nil {
+		return err
+	}
+	if reply.ErrCode != 0 {
+		return errno.Errorf("send alarm to bot err, errcode: %d, errmsg: %s", reply.ErrCode, reply.ErrMsg)
+	}
+	if reply.Code != 0 {
+		return errno.Errorf("send alarm to bot err, code: %d, msg: %s", reply.Code, reply.Msg)
+	}
+	return nil
+}
+
+func hmacBase64(key, data string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(data))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// NewDingTalk 钉钉群机器人, secret 为加签密钥, 没有开启加签时填空. 内容超过 MaxDingTalkBytes 时截断
+func NewDingTalk(webhook, secret string) Sender {
+	return SenderFunc(func(subject, body string) error {
+		target := webhook
+		if secret != "" {
+			ts := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+			sign := hmacBase64(secret, ts+"\n"+secret)
+			target += "&timestamp=" + ts + "&sign=" + url.QueryEscape(sign)
+		}
+		return postBot(target, map[string]interface{}{
+			"msgtype": "markdown",
+			"markdown": map[string]string{
+				"title": subject,
+				"text":  truncate("### "+subject+"\n\n"+toMarkdown(body), MaxDingTalkBytes),
+			},
+		})
+	})
+}
+
+// NewWeCom 企业微信群机器人, markdown 内容超过 MaxWeComBytes 时截断
+func NewWeCom(webhook string) Sender {
+	return SenderFunc(func(subject, body string) error {
+		return postBot(webhook, map[string]interface{}{
+			"msgtype": "markdown",
+			"markdown": map[string]string{
+				"content": truncate("### "+subject+"\n"+toMarkdown(body), MaxWeComBytes),
+			},
+		})
+	})
+}
+
+// NewFeishu 飞书群机器人, secret 为签名校验密钥, 没有开启签名校验时填空. 内容超过 MaxFeishuBytes 时截断
+func NewFeishu(webhook, secret string) Sender {
+	return SenderFunc(func(subject, body string) error {
+		payload := map[string]interface{}{
+			"msg_type": "text",
+			"content": map[string]string{
+				"text": truncate(subject+"\n"+toMarkdown(body), MaxFeishuBytes),
+			},
+		}
+		if secret != "" {
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			payload["timestamp"] = ts
+			payload["sign"] = hmacBase64(ts+"\n"+secret, "")
+		}
+		return postBot(webhook, payload)
+	})
+}
@@ -40,6 +40,8 @@ var (
 	paramBindErrorCode = tooManyRequestsCode + 1
 	// MySQLExecError 110004 数据库执行时报错, 一般用作未知的SQL执行异常.
 	mySQLExecErrorCode = paramBindErrorCode + 1
+	// ServiceUnavailable 110005 下游服务熔断或者没有可用的服务实例.
+	serviceUnavailableCode = mySQLExecErrorCode + 1
 )
 
 func SetServerErrorCode(code int) {
@@ -78,6 +80,15 @@ func GetMySQLExecErrorCode() (code int) {
 	return
 }
 
+func SetServiceUnavailableCode(code int) {
+	serviceUnavailableCode = code
+}
+
+func GetServiceUnavailableCode() (code int) {
+	code = serviceUnavailableCode
+	return
+}
+
 var lang string
 
 func SetLang(l string) {
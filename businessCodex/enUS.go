@@ -2,9 +2,10 @@ package businessCodex
 
 var enUSText = func() map[int]string {
 	return map[int]string{
-		GetMySQLExecErrorCode(): "Internal server error",
-		GetMySQLExecErrorCode(): "Too many requests",
-		GetMySQLExecErrorCode(): "Parameter error",
-		GetMySQLExecErrorCode(): "SQL execution failed",
+		GetMySQLExecErrorCode():     "Internal server error",
+		GetMySQLExecErrorCode():     "Too many requests",
+		GetMySQLExecErrorCode():     "Parameter error",
+		GetMySQLExecErrorCode():     "SQL execution failed",
+		GetServiceUnavailableCode(): "Service unavailable",
 	}
 }
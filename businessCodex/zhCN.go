@@ -2,9 +2,10 @@ package businessCodex
 
 var zhCNText = func() map[int]string {
 	return map[int]string{
-		GetMySQLExecErrorCode(): "内部服务器错误",
-		GetMySQLExecErrorCode(): "请求过多",
-		GetMySQLExecErrorCode(): "参数信息错误",
-		GetMySQLExecErrorCode(): "SQL 执行失败",
+		GetMySQLExecErrorCode():     "内部服务器错误",
+		GetMySQLExecErrorCode():     "请求过多",
+		GetMySQLExecErrorCode():     "参数信息错误",
+		GetMySQLExecErrorCode():     "SQL 执行失败",
+		GetServiceUnavailableCode(): "服务暂不可用",
 	}
 }
@@ -2,6 +2,7 @@ package clickhousex
 
 import (
 	"fmt"
+	"github.com/chenxinqun/ginWarpPkg/datax/gormx"
 	"github.com/chenxinqun/ginWarpPkg/sysx/environment"
 	"github.com/pkg/errors"
 	"gorm.io/driver/clickhouse"
@@ -48,6 +49,7 @@ type Info struct {
 	ReadTimeOut     int           `toml:"ReadTimeOut" json:"ReadTimeOut"`         // 读超时时间
 	WriteTimeOut    int           `toml:"WriteTimeOut" json:"WriteTimeOut"`       // 写超时时间
 	ConnMaxLifeTime time.Duration `toml:"ConnMaxLifeTime" json:"ConnMaxLifeTime"` // 最大连接超时时间, 单位分钟
+	SlowThreshold   int           `toml:"SlowThreshold" json:"SlowThreshold"`     // 慢查询阈值, 单位毫秒
 }
 
 var _ Repo = (*DB)(nil)
@@ -73,6 +75,9 @@ func New(cfg Info) (Repo, error) {
 	if err != nil {
 		return nil, err
 	}
+	// 注册链路追踪插件
+	_ = db.Use(gormx.NewPlugin(gormx.Config{Name: "clickhouse/" + cfg.Name, SlowThreshold: cfg.SlowThreshold}))
+
 	if environment.Active() != nil {
 		// 如果不是Pro和Pre环境, 开启db.Debug()模式
 		if !environment.Active().IsPro() && !environment.Active().IsPre() {
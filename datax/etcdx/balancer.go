@@ -0,0 +1,225 @@
+package etcdx
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MetaWeight 加权轮询时, 从 ServiceInfo.Meta 中读取权重的 key, 不填或者不合法时权重为 1
+const MetaWeight = "weight"
+
+// 全局只初始化一次随机数种子, 避免每次调用都重新设置种子
+var (
+	rngMu sync.Mutex
+	rng   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// RandIntn 并发安全的 rand.Intn, 使用全局的随机数生成器, 其它包需要随机数时直接使用
+func RandIntn(n int) int {
+	rngMu.Lock()
+	defer rngMu.Unlock()
+	return rng.Intn(n)
+}
+
+func randPerm(n int) []int {
+	rngMu.Lock()
+	defer rngMu.Unlock()
+	return rng.Perm(n)
+}
+
+// instanceID 服务实例的唯一标识, 没有 ID 时使用地址
+func instanceID(s ServiceInfo) string {
+	if s.ID != "" {
+		return s.ID
+	}
+	return s.Url()
+}
+
+// InFlight 记录每个服务实例正在处理中的请求数, 供最少请求和 P2C 策略使用.
+// 由调用方在真实请求前后调用 Start 和返回的 done 来维护.
+type InFlight struct {
+	counts sync.Map
+}
+
+func NewInFlight() *InFlight {
+	return new(InFlight)
+}
+
+// Start 开始一个请求, 请求结束后需要调用返回的 done
+func (f *InFlight) Start(s ServiceInfo) (done func()) {
+	v, _ := f.counts.LoadOrStore(instanceID(s), new(int64))
+	n := v.(*int64)
+	atomic.AddInt64(n, 1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			atomic.AddInt64(n, -1)
+		})
+	}
+}
+
+// Count 实例正在处理中的请求数
+func (f *InFlight) Count(s ServiceInfo) int64 {
+	if v, ok := f.counts.Load(instanceID(s)); ok {
+		return atomic.LoadInt64(v.(*int64))
+	}
+	return 0
+}
+
+// ServiceArray 使用负载均衡策略对实例排序, 默认为随机策略. 不依赖 etcd, 其它服务发现方式也可以使用
+func ServiceArray(l []ServiceRegister, balancer ...BalancerFunc) []ServiceInfo {
+	b := BalancerFunc(RandomPermPolicy)
+	if len(balancer) == 1 && balancer[0] != nil {
+		b = balancer[0]
+	}
+	switch ret := b(l).(type) {
+	case []ServiceInfo:
+		return ret
+	case ServiceInfo:
+		return []ServiceInfo{ret}
+	}
+	return nil
+}
+
+// 以下策略都返回排好序的 []ServiceInfo, 第一个为选中的实例, 后面的作为失败时的备选.
+// GetService 使用这些策略时取第一个.
+
+// RoundRobinPolicy 轮询, 按服务名称分别计数
+func RoundRobinPolicy() BalancerFunc {
+	var counters sync.Map
+	return func(l []ServiceRegister) interface{} {
+		if len(l) == 0 {
+			return []ServiceInfo{}
+		}
+		v, _ := counters.LoadOrStore(l[0].Val.Name, new(uint64))
+		start := int((atomic.AddUint64(v.(*uint64), 1) - 1) % uint64(len(l)))
+		ret := make([]ServiceInfo, 0, len(l))
+		for i := 0; i < len(l); i++ {
+			ret = append(ret, l[(start+i)%len(l)].Val)
+		}
+		return ret
+	}
+}
+
+func metaWeight(s ServiceInfo) int {
+	if w, err := strconv.Atoi(s.Meta[MetaWeight]); err == nil && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// WeightedRoundRobinPolicy 平滑加权轮询(与 nginx 相同的算法), 权重从 ServiceInfo.Meta[MetaWeight] 读取.
+// 每个服务单独计算, 同一个策略可以用于多个服务.
+func WeightedRoundRobinPolicy() BalancerFunc {
+	w := &weightedRoundRobin{current: make(map[string]map[string]int)}
+	return w.pick
+}
+
+type weightedRoundRobin struct {
+	mu sync.Mutex
+	// 服务名 -> 实例 -> 当前权重
+	current map[string]map[string]int
+}
+
+func (w *weightedRoundRobin) pick(l []ServiceRegister) interface{} {
+	if len(l) == 0 {
+		return []ServiceInfo{}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	name := l[0].Val.Name
+	current, ok := w.current[name]
+	if !ok {
+		current = make(map[string]int, len(l))
+		w.current[name] = current
+	}
+	live := make(map[string]struct{}, len(l))
+	total := 0
+	best := -1
+	for i, sr := range l {
+		id := instanceID(sr.Val)
+		live[id] = struct{}{}
+		weight := metaWeight(sr.Val)
+		total += weight
+		current[id] += weight
+		if best < 0 || current[id] > current[instanceID(l[best].Val)] {
+			best = i
+		}
+	}
+	current[instanceID(l[best].Val)] -= total
+	// 清理已经下线的实例, 避免实例频繁变化时无限增长
+	for id := range current {
+		if _, ok := live[id]; !ok {
+			delete(current, id)
+		}
+	}
+
+	ret := make([]ServiceInfo, 0, len(l))
+	ret = append(ret, l[best].Val)
+	rest := make([]ServiceInfo, 0, len(l)-1)
+	for i, sr := range l {
+		if i != best {
+			rest = append(rest, sr.Val)
+		}
+	}
+	// 备选实例按当前权重从高到低排列
+	sort.SliceStable(rest, func(i, j int) bool {
+		return current[instanceID(rest[i])] > current[instanceID(rest[j])]
+	})
+	return append(ret, rest...)
+}
+
+// LeastOutstandingPolicy 最少请求, 优先选择正在处理中的请求数最少的实例, 请求数相同时随机
+func LeastOutstandingPolicy(inFlight *InFlight) BalancerFunc {
+	return func(l []ServiceRegister) interface{} {
+		ret := RandomPermPolicy(l).([]ServiceInfo)
+		sort.SliceStable(ret, func(i, j int) bool {
+			return inFlight.Count(ret[i]) < inFlight.Count(ret[j])
+		})
+		return ret
+	}
+}
+
+// P2CPolicy 两次随机选择(power of two choices), 随机取两个实例, 选择正在处理中的请求数少的那个
+func P2CPolicy(inFlight *InFlight) BalancerFunc {
+	return func(l []ServiceRegister) interface{} {
+		ret := RandomPermPolicy(l).([]ServiceInfo)
+		if len(ret) >= 2 && inFlight.Count(ret[1]) < inFlight.Count(ret[0]) {
+			ret[0], ret[1] = ret[1], ret[0]
+		}
+		return ret
+	}
+}
+
+// ConsistentHashPolicy 按请求的 key (如 TenantID) 做一致性哈希, 相同的 key 总是落到同一个实例上,
+// 实例增减时只有少量 key 会迁移. 使用最高随机权重(rendezvous)哈希实现, 备选实例的顺序也是稳定的.
+func ConsistentHashPolicy(key string) BalancerFunc {
+	return func(l []ServiceRegister) interface{} {
+		type scored struct {
+			score uint64
+			val   ServiceInfo
+		}
+		list := make([]scored, 0, len(l))
+		for _, sr := range l {
+			h := fnv.New64a()
+			_, _ = h.Write([]byte(key))
+			_, _ = h.Write([]byte{0})
+			_, _ = h.Write([]byte(instanceID(sr.Val)))
+			list = append(list, scored{score: h.Sum64(), val: sr.Val})
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].score > list[j].score
+		})
+		ret := make([]ServiceInfo, 0, len(list))
+		for _, s := range list {
+			ret = append(ret, s.val)
+		}
+		return ret
+	}
+}
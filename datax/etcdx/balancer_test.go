@@ -0,0 +1,110 @@
+package etcdx
+
+import (
+	"testing"
+)
+
+func testRegisters(weights ...string) []ServiceRegister {
+	l := make([]ServiceRegister, 0, len(weights))
+	for i, w := range weights {
+		l = append(l, ServiceRegister{Val: ServiceInfo{
+			ID:   string(rune('a' + i)),
+			Name: "svc",
+			Meta: map[string]string{MetaWeight: w},
+		}})
+	}
+	return l
+}
+
+func first(b BalancerFunc, l []ServiceRegister) string {
+	return b(l).([]ServiceInfo)[0].ID
+}
+
+func TestRoundRobinPolicy(t *testing.T) {
+	l := testRegisters("1", "1", "1")
+	b := RoundRobinPolicy()
+	got := ""
+	for i := 0; i < 6; i++ {
+		got += first(b, l)
+	}
+	if got != "abcabc" {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestWeightedRoundRobinPolicy(t *testing.T) {
+	l := testRegisters("5", "1", "1")
+	b := WeightedRoundRobinPolicy()
+	counts := map[string]int{}
+	for i := 0; i < 70; i++ {
+		counts[first(b, l)]++
+	}
+	if counts["a"] != 50 || counts["b"] != 10 || counts["c"] != 10 {
+		t.Fatalf("got %v", counts)
+	}
+}
+
+func TestWeightedRoundRobinPrune(t *testing.T) {
+	w := &weightedRoundRobin{current: make(map[string]map[string]int)}
+	other := testRegisters("1", "1")
+	for i := range other {
+		other[i].Val.Name = "other"
+	}
+	counts := map[string]int{}
+	for i := 0; i < 70; i++ {
+		// 多个服务交替使用同一个策略, 互不影响
+		counts[w.pick(testRegisters("5", "1", "1")).([]ServiceInfo)[0].ID]++
+		w.pick(other)
+	}
+	if counts["a"] != 50 || counts["b"] != 10 || counts["c"] != 10 {
+		t.Fatalf("got %v", counts)
+	}
+
+	// 实例 c 下线后不再保留它的权重
+	w.pick(testRegisters("5", "1"))
+	if _, ok := w.current["svc"]["c"]; ok || len(w.current["svc"]) != 2 {
+		t.Fatalf("stale instance not pruned: %v", w.current["svc"])
+	}
+	if len(w.current["other"]) != 2 {
+		t.Fatalf("other service pruned: %v", w.current["other"])
+	}
+}
+
+func TestLeastOutstandingAndP2C(t *testing.T) {
+	l := testRegisters("1", "1")
+	f := NewInFlight()
+	done := f.Start(l[0].Val)
+	for i := 0; i < 10; i++ {
+		if got := first(LeastOutstandingPolicy(f), l); got != "b" {
+			t.Fatalf("least outstanding got %s", got)
+		}
+		if got := first(P2CPolicy(f), l); got != "b" {
+			t.Fatalf("p2c got %s", got)
+		}
+	}
+	done()
+	done()
+	if n := f.Count(l[0].Val); n != 0 {
+		t.Fatalf("in flight should be 0, got %d", n)
+	}
+}
+
+func TestConsistentHashPolicy(t *testing.T) {
+	l := testRegisters("1", "1", "1", "1")
+	want := first(ConsistentHashPolicy("tenant-1"), l)
+	for i := 0; i < 5; i++ {
+		if got := first(ConsistentHashPolicy("tenant-1"), l); got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+	}
+	// 删除一个其他实例, 不影响已有 key 的落点
+	rest := make([]ServiceRegister, 0)
+	for _, sr := range l {
+		if sr.Val.ID == want || len(rest) < 2 {
+			rest = append(rest, sr)
+		}
+	}
+	if got := first(ConsistentHashPolicy("tenant-1"), rest); got != want {
+		t.Fatalf("got %s after removing an instance, want %s", got, want)
+	}
+}
@@ -0,0 +1,311 @@
+package etcdx
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/errno"
+
+	"github.com/gin-gonic/gin/binding"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientV3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+// Binding 绑定到结构体的配置, 通过 Bind 创建. 配置变更时整体替换, Get 总是返回一份完整并且校验通过的配置.
+type Binding[T any] struct {
+	repo     Repo
+	prefix   string
+	defaults T
+	value    atomic.Value
+	logger   *zap.Logger
+	cancel   context.CancelFunc
+
+	mu sync.Mutex
+	// 配置中心当前的原始配置, key 为去掉前缀后的相对路径
+	raw         map[string][]byte
+	subscribers []func(old, new *T)
+}
+
+// Bind 把配置中心 conf 前缀下的配置解析到 T 中, 并监听变更热更新.
+//
+// 每个 key 对应一个字段, 字段名按 toml, json tag, 字段名的顺序匹配, 嵌套结构体用 / 分隔, 如 mysql/addr;
+// 也可以用一个 key 保存整个嵌套结构体的 json. 字符串类型的字段原样保存, 不会把 "007" 转换成 7,
+// time.Duration 可以写成 "5s" 这样的格式. 配置中心没有的字段使用 dst 中原来的值作为默认值.
+//
+// 解析后使用 binding tag 校验, 初始配置不合法时返回错误; 更新后的配置不合法时回滚这次变更, 继续使用上一次合法的配置.
+// dst 只在初始化时写入, 之后通过 Get 获取最新的配置. 不再需要时调用 Close 停止监听.
+func Bind[T any](repo Repo, conf ConfigInfo, dst *T) (*Binding[T], error) {
+	if repo == nil {
+		return nil, errno.NewError("etcd repo not initialized")
+	}
+	if dst == nil {
+		return nil, errno.NewError("bind dst must not be nil")
+	}
+	conf.SetPrefix()
+	b := &Binding[T]{
+		repo:     repo,
+		prefix:   conf.Prefix,
+		defaults: *dst,
+		logger:   repo.GetRepo().Logger,
+		raw:      make(map[string][]byte),
+	}
+
+	resp, err := b.get()
+	if err != nil {
+		return nil, err
+	}
+	for _, kv := range resp.Kvs {
+		b.raw[strings.TrimPrefix(string(kv.Key), b.prefix)] = kv.Value
+	}
+	val, err := b.decode(b.raw)
+	if err != nil {
+		return nil, err
+	}
+	b.value.Store(val)
+	*dst = *val
+
+	// 从读取时的下一个版本开始监听, 读取之后的变更不会丢失
+	var watchCtx context.Context
+	watchCtx, b.cancel = context.WithCancel(context.Background())
+	// 监听的版本被压缩时重新读取所有配置, 再从新的版本继续监听
+	go repo.GetRepo().watchFrom(watchCtx, b.prefix, resp.Header.Revision+1, b.watch, b.reload)
+	return b, nil
+}
+
+// Close 停止监听配置变更, 之后 Get 返回最后一次的配置
+func (b *Binding[T]) Close() {
+	if b.cancel != nil {
+		b.cancel()
+	}
+}
+
+// Get 当前的配置, 返回的值不要修改
+func (b *Binding[T]) Get() *T {
+	return b.value.Load().(*T)
+}
+
+// OnChange 订阅配置变更, 在配置整体替换之后调用
+func (b *Binding[T]) OnChange(fn func(old, new *T)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, fn)
+}
+
+func (b *Binding[T]) get() (*clientV3.GetResponse, error) {
+	ctx, cancel := b.repo.TimeOutCtx(10)
+	defer cancel()
+	return b.repo.GetConn().Get(ctx, b.prefix, clientV3.WithPrefix())
+}
+
+func (b *Binding[T]) watch(_ Repo, wresp clientV3.WatchResponse) {
+	b.update(func(raw map[string][]byte) {
+		for _, ev := range wresp.Events {
+			key := strings.TrimPrefix(string(ev.Kv.Key), b.prefix)
+			switch ev.Type {
+			case mvccpb.PUT:
+				raw[key] = ev.Kv.Value
+			case mvccpb.DELETE:
+				delete(raw, key)
+			}
+		}
+	})
+}
+
+// reload 监听中断后重新读取前缀下的所有配置, 返回读取时的版本
+func (b *Binding[T]) reload() (int64, error) {
+	resp, err := b.get()
+	if err != nil {
+		return 0, err
+	}
+	b.update(func(raw map[string][]byte) {
+		for key := range raw {
+			delete(raw, key)
+		}
+		for _, kv := range resp.Kvs {
+			raw[strings.TrimPrefix(string(kv.Key), b.prefix)] = kv.Value
+		}
+	})
+	return resp.Header.Revision, nil
+}
+
+// update 在原始配置的副本上修改后解析, 合法时整体替换并通知订阅者, 不合法时继续使用上一次的配置
+func (b *Binding[T]) update(modify func(raw map[string][]byte)) {
+	b.mu.Lock()
+	raw := make(map[string][]byte, len(b.raw))
+	for k, v := range b.raw {
+		raw[k] = v
+	}
+	modify(raw)
+	val, err := b.decode(raw)
+	if err != nil {
+		b.mu.Unlock()
+		b.logger.Error("配置不合法, 回滚到上一次的配置", zap.String("prefix", b.prefix), zap.Error(err))
+		return
+	}
+	b.raw = raw
+	old := b.Get()
+	b.value.Store(val)
+	subscribers := make([]func(old, new *T), len(b.subscribers))
+	copy(subscribers, b.subscribers)
+	b.mu.Unlock()
+
+	b.logger.Info("配置更新", zap.String("prefix", b.prefix))
+	for _, fn := range subscribers {
+		fn(old, val)
+	}
+}
+
+// decode 在默认值的副本上解析配置并校验
+func (b *Binding[T]) decode(raw map[string][]byte) (*T, error) {
+	val := new(T)
+	rv := reflect.ValueOf(val).Elem()
+	rv.Set(cloneValue(reflect.ValueOf(&b.defaults).Elem()))
+	if rv.Kind() == reflect.Struct {
+		if err := decodeStruct(rv, "", raw); err != nil {
+			return nil, err
+		}
+	}
+	if err := binding.Validator.ValidateStruct(val); err != nil {
+		return nil, errno.Wrapf(err, "validate config %s err", b.prefix)
+	}
+	return val, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// cloneValue 深拷贝, 指针, 切片和 map 都复制一份, 解析配置时不会修改默认值. 不导出的字段只做浅拷贝
+func cloneValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		ret := reflect.New(v.Type().Elem())
+		ret.Elem().Set(cloneValue(v.Elem()))
+		return ret
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		ret := reflect.New(v.Type()).Elem()
+		ret.Set(cloneValue(v.Elem()))
+		return ret
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		ret := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			ret.Index(i).Set(cloneValue(v.Index(i)))
+		}
+		return ret
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		ret := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			ret.SetMapIndex(iter.Key(), cloneValue(iter.Value()))
+		}
+		return ret
+	case reflect.Array, reflect.Struct:
+		ret := reflect.New(v.Type()).Elem()
+		ret.Set(v)
+		if v.Kind() == reflect.Array {
+			for i := 0; i < v.Len(); i++ {
+				ret.Index(i).Set(cloneValue(v.Index(i)))
+			}
+			return ret
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				ret.Field(i).Set(cloneValue(v.Field(i)))
+			}
+		}
+		return ret
+	}
+	return v
+}
+
+func decodeStruct(rv reflect.Value, prefix string, raw map[string][]byte) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := fieldName(field)
+		if name == "-" {
+			continue
+		}
+		key := prefix + name
+		fv := rv.Field(i)
+		if val, ok := lookup(raw, key); ok {
+			if err := decodeValue(fv, val); err != nil {
+				return errno.Wrapf(err, "decode config `%s` err", key)
+			}
+			continue
+		}
+		if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Time{}) {
+			if err := decodeStruct(fv, key+"/", raw); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"toml", "json"} {
+		if name := strings.Split(field.Tag.Get(tag), ",")[0]; name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// lookup 先精确匹配, 再忽略大小写匹配
+func lookup(raw map[string][]byte, key string) ([]byte, bool) {
+	if val, ok := raw[key]; ok {
+		return val, true
+	}
+	for k, val := range raw {
+		if strings.EqualFold(k, key) {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+func decodeValue(fv reflect.Value, val []byte) error {
+	sv := strings.TrimSpace(string(val))
+	switch {
+	case fv.Kind() == reflect.String:
+		fv.SetString(string(val))
+		return nil
+	case fv.Type() == durationType:
+		if d, err := time.ParseDuration(sv); err == nil {
+			fv.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(sv, 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+		return nil
+	}
+	// map 整体替换, 不和默认值合并
+	if fv.Kind() == reflect.Map {
+		fv.Set(reflect.Zero(fv.Type()))
+	}
+	return json.Unmarshal([]byte(sv), fv.Addr().Interface())
+}
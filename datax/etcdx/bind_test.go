@@ -0,0 +1,181 @@
+package etcdx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/sysx/environment"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientV3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+type testMySQL struct {
+	Addr string `toml:"addr" binding:"required"`
+	Pool int    `toml:"pool"`
+}
+
+type testConf struct {
+	Code    string            `toml:"code"`
+	Debug   bool              `json:"debug"`
+	Timeout time.Duration     `toml:"timeout"`
+	Limit   int               `toml:"limit" binding:"min=1"`
+	Tags    map[string]string `toml:"tags"`
+	MySQL   testMySQL         `toml:"mysql"`
+}
+
+func testBinding(raw map[string][]byte) (*Binding[testConf], error) {
+	b := &Binding[testConf]{
+		prefix:   "/Config/dev/test/",
+		defaults: testConf{Limit: 10, Tags: map[string]string{"a": "1"}, MySQL: testMySQL{Addr: "127.0.0.1:3306", Pool: 5}},
+		logger:   zap.NewNop(),
+		raw:      raw,
+	}
+	val, err := b.decode(raw)
+	if err != nil {
+		return nil, err
+	}
+	b.value.Store(val)
+	return b, nil
+}
+
+func putEvent(key, val string) *clientV3.Event {
+	return &clientV3.Event{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte("/Config/dev/test/" + key), Value: []byte(val)}}
+}
+
+func TestBindDecode(t *testing.T) {
+	b, err := testBinding(map[string][]byte{
+		"code":       []byte("007"),
+		"debug":      []byte("true"),
+		"timeout":    []byte("5s"),
+		"tags":       []byte(`{"b":"2"}`),
+		"mysql/pool": []byte("20"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := b.Get()
+	if c.Code != "007" || !c.Debug || c.Timeout != 5*time.Second || c.Limit != 10 {
+		t.Fatalf("unexpected config %+v", c)
+	}
+	if c.MySQL.Addr != "127.0.0.1:3306" || c.MySQL.Pool != 20 {
+		t.Fatalf("unexpected nested config %+v", c.MySQL)
+	}
+	if len(c.Tags) != 1 || c.Tags["b"] != "2" || b.defaults.Tags["b"] != "" {
+		t.Fatalf("map should replace defaults without modifying them: %v %v", c.Tags, b.defaults.Tags)
+	}
+}
+
+func TestBindDecodeDefaultsNotModified(t *testing.T) {
+	type sub struct {
+		Pool  int      `toml:"pool"`
+		Hosts []string `toml:"hosts"`
+	}
+	type conf struct {
+		Sub   *sub     `toml:"sub"`
+		Hosts []string `toml:"hosts"`
+	}
+	b := &Binding[conf]{
+		prefix:   "/Config/dev/test/",
+		defaults: conf{Sub: &sub{Pool: 5, Hosts: []string{"a", "b"}}, Hosts: []string{"a", "b"}},
+		logger:   zap.NewNop(),
+	}
+	c, err := b.decode(map[string][]byte{
+		"sub":   []byte(`{"pool":20,"hosts":["c"]}`),
+		"hosts": []byte(`["c"]`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Sub.Pool != 20 || len(c.Sub.Hosts) != 1 || len(c.Hosts) != 1 || c.Hosts[0] != "c" {
+		t.Fatalf("unexpected config %+v %+v", c, c.Sub)
+	}
+	d := b.defaults
+	if d.Sub.Pool != 5 || d.Sub.Hosts[0] != "a" || d.Hosts[0] != "a" || d.Hosts[1] != "b" {
+		t.Fatalf("defaults modified: %+v %+v", d, d.Sub)
+	}
+
+	// 没有配置时使用默认值的副本, 修改返回值不影响默认值
+	c, err = b.decode(map[string][]byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Sub.Pool, c.Hosts[0] = 1, "x"
+	if d.Sub.Pool != 5 || d.Hosts[0] != "a" {
+		t.Fatalf("defaults shared with config: %+v %+v", d, d.Sub)
+	}
+}
+
+func TestBindValidate(t *testing.T) {
+	if _, err := testBinding(map[string][]byte{"limit": []byte("0")}); err == nil {
+		t.Fatal("expected validate error")
+	}
+	if _, err := testBinding(map[string][]byte{"limit": []byte("abc")}); err == nil {
+		t.Fatal("expected decode error")
+	}
+}
+
+func TestBindWatch(t *testing.T) {
+	b, err := testBinding(map[string][]byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changes int
+	b.OnChange(func(old, new *testConf) {
+		changes++
+		if old.Limit != 10 || new.Limit != 20 {
+			t.Fatalf("unexpected change %d -> %d", old.Limit, new.Limit)
+		}
+	})
+
+	b.watch(nil, clientV3.WatchResponse{Events: []*clientV3.Event{putEvent("limit", "20")}})
+	if b.Get().Limit != 20 || changes != 1 {
+		t.Fatalf("update not applied: %d %d", b.Get().Limit, changes)
+	}
+
+	// 不合法的更新整体回滚, 同一批次中合法的修改也不生效
+	b.watch(nil, clientV3.WatchResponse{Events: []*clientV3.Event{putEvent("code", "x"), putEvent("limit", "0")}})
+	if b.Get().Limit != 20 || b.Get().Code != "" || changes != 1 {
+		t.Fatalf("invalid update should be rejected: %+v", b.Get())
+	}
+	if _, ok := b.raw["code"]; ok {
+		t.Fatal("raw config should be rolled back")
+	}
+}
+
+func TestBindCompacted(t *testing.T) {
+	kv := func(key, val string) *mvccpb.KeyValue {
+		return &mvccpb.KeyValue{Key: []byte("/Config/dev/test/" + key), Value: []byte(val)}
+	}
+	kvs := &scriptKV{responses: []*clientV3.GetResponse{
+		{Header: &pb.ResponseHeader{Revision: 10}, Kvs: []*mvccpb.KeyValue{kv("limit", "20")}},
+		// 压缩之后重新读取, 中间的变更丢失了, 以重新读取的结果为准
+		{Header: &pb.ResponseHeader{Revision: 40}, Kvs: []*mvccpb.KeyValue{kv("code", "x")}},
+	}}
+	watcher := &scriptWatcher{rounds: [][]clientV3.WatchResponse{{
+		{Events: []*clientV3.Event{putEvent("limit", "30")}},
+		{CompactRevision: 30, Canceled: true},
+	}}}
+	e := &DB{Logger: zap.NewNop(), client: &clientV3.Client{KV: kvs, Watcher: watcher}}
+
+	environment.InitEnv("dev")
+	dst := testConf{Limit: 10, MySQL: testMySQL{Addr: "127.0.0.1:3306"}}
+	b, err := Bind(e, ConfigInfo{Namespace: "dev", Name: "test"}, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for len(watcher.watchRevs()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if revs := watcher.watchRevs(); len(revs) != 2 || revs[0] != 11 || revs[1] != 41 {
+		t.Fatalf("watch revisions = %v, want [11 41]", revs)
+	}
+	if got := b.Get(); got.Limit != 10 || got.Code != "x" {
+		t.Fatalf("config after compaction = %+v", got)
+	}
+}
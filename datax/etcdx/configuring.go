@@ -68,21 +68,29 @@ func (e *DB) Configuring(conf ConfigInfo, setFunc SetConfFunc, watcher ...Watche
 }
 
 // 监控配置变动的默认函数, 这个函数是一个范例. 真实项目中一般需要自定义.
-// 配置文件, 默认只支持修改, 不支持删除, 因为删除配置项容易导致程序出问题, 尤其是使用的结构体做配置的时候.
-// 配置文件修改的原则应该是只热更新与业务有关的配置项, 一般为开关类的配置以及短连接的地址配置. 数据库相关的需要连接池, 或者长连接配置一般不修改.
+// 配置修改的原则应该是只热更新与业务有关的配置项, 一般为开关类的配置以及短连接的地址配置. 数据库相关的需要连接池, 或者长连接配置一般不修改.
+// 删除的配置项会从 GetConfigs 中移除, 使用结构体做配置时请用 Bind, 删除的字段会恢复为默认值.
+// 每次变更都会记录修改前后的值和 revision, 可以通过 GetConfigHistory 查看历史, RollbackConfig 回滚.
 func confWatcher(er Repo, wresp clientV3.WatchResponse) {
 	for _, ev := range wresp.Events {
 		key := strings.TrimPrefix(string(ev.Kv.Key), er.GetRepo().ConfigInfo.Prefix)
+		var old []byte
+		if ev.PrevKv != nil {
+			old = ev.PrevKv.Value
+		}
+		fields := []zap.Field{zap.String("key", key), zap.Int64("revision", ev.Kv.ModRevision), zap.ByteString("原配置", old)}
 		switch ev.Type {
 		case mvccpb.PUT: //修改或者新增
-			// 新增配置
+			fields = append(fields, zap.ByteString("新配置", ev.Kv.Value))
 			if ev.Kv.Version == 1 {
-				er.GetRepo().Logger.Info("配置新增", zap.String(key, string(ev.Kv.Value)))
+				er.GetRepo().Logger.Info("配置新增", fields...)
 			} else {
-				// 改动配置
-				er.GetRepo().Logger.Info("配置改动", zap.String("key", key), zap.Any("原配置", er.GetConfigs()[key]), zap.String("新配置", string(ev.Kv.Value)))
+				er.GetRepo().Logger.Info("配置改动", fields...)
 			}
 			er.SetConfig(key, ev.Kv.Value)
+		case mvccpb.DELETE:
+			er.GetRepo().Logger.Info("配置删除", fields...)
+			er.GetRepo().DelConfig(key)
 		}
 	}
 }
@@ -146,6 +154,13 @@ func (e *DB) SetConfig(key string, val []byte, listing ...ConfigStringMap) {
 	conf[key] = value
 }
 
+// DelConfig 删除配置项.
+func (e *DB) DelConfig(key string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.configListing, key)
+}
+
 func (e *DB) GetConfigs() ConfigStringMap {
 	return e.configListing
 }
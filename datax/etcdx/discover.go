@@ -3,9 +3,7 @@ package etcdx
 import (
 	"encoding/json"
 	"fmt"
-	"math/rand"
 	"strings"
-	"time"
 
 	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientV3 "go.etcd.io/etcd/client/v3"
@@ -124,13 +122,14 @@ func (e *DB) GetServiceListing() ServiceListing {
 }
 
 func RandomPolicy(l []ServiceRegister) interface{} {
-	rand.Seed(time.Now().UnixNano())
-	return l[rand.Intn(len(l))].Val
+	if len(l) == 0 {
+		return nil
+	}
+	return l[RandIntn(len(l))].Val
 }
 
 func RandomPermPolicy(l []ServiceRegister) interface{} {
-	rand.Seed(time.Now().UnixNano())
-	randIndex := rand.Perm(len(l))
+	randIndex := randPerm(len(l))
 	ret := make([]ServiceInfo, 0, len(l))
 	for _, v := range randIndex {
 		ret = append(ret, l[v].Val)
@@ -177,8 +176,14 @@ func (e *DB) GetService(s ServiceInfo, balancer ...BalancerFunc) ServiceInfo {
 	}
 	if m, ok := e.serviceListing[s.Name]; ok {
 		if l, ok := m[s.Scheme]; ok {
-			if ret, ok := b(l).(ServiceInfo); ok {
+			switch ret := b(l).(type) {
+			case ServiceInfo:
 				return ret
+			case []ServiceInfo:
+				// 返回排序列表的策略, 取第一个
+				if len(ret) > 0 {
+					return ret[0]
+				}
 			}
 		}
 	}
@@ -195,16 +200,19 @@ func (e *DB) GetServiceArray(s ServiceInfo, balancer ...BalancerFunc) []ServiceI
 	} else {
 		b = RandomPermPolicy
 	}
-	if m, ok := e.serviceListing[s.Name]; ok {
-		if l, ok := m[s.Scheme]; ok {
-			if ret, ok := b(l).([]ServiceInfo); ok {
-				return ret
-			}
-		}
+	if l := e.GetServiceRegisters(s.Name, s.Scheme); len(l) > 0 {
+		return ServiceArray(l, b)
 	}
 	return nil
 }
 
+// GetServiceRegisters 获取服务的所有实例, 返回的是副本, 可以在服务变更时安全使用
+func (e *DB) GetServiceRegisters(name, scheme string) []ServiceRegister {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]ServiceRegister(nil), e.serviceListing[name][scheme]...)
+}
+
 func (e *DB) IsDiscovered() bool {
 	return e.discovered
 }
@@ -89,7 +89,15 @@ func (e *DB) TimeOutCtx(ttl int) (ctx context.Context, cancel context.CancelFunc
 }
 
 func (e *DB) Watcher(prefix string, watcherFunc WatcherFunc) {
-	rch := e.client.Watch(context.Background(), prefix, clientV3.WithPrefix())
+	e.WatcherWithContext(context.Background(), prefix, watcherFunc)
+}
+
+// WatcherWithContext 与 Watcher 相同, ctx 取消时停止监听并返回. opts 追加在默认的选项之后,
+// 如 clientV3.WithRev 从指定版本开始监听, 避免读取和监听之间的变更丢失
+func (e *DB) WatcherWithContext(ctx context.Context, prefix string, watcherFunc WatcherFunc, opts ...clientV3.OpOption) {
+	// 带上修改前的值, 用于记录配置变更的审计日志
+	opts = append([]clientV3.OpOption{clientV3.WithPrefix(), clientV3.WithPrevKV()}, opts...)
+	rch := e.client.Watch(ctx, prefix, opts...)
 	for wresp := range rch {
 		watcherFunc(e, wresp)
 	}
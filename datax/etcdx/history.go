@@ -0,0 +1,253 @@
+package etcdx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/errno"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientV3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+const (
+	// 读取历史时, 超过这个时间没有新的事件就认为已经读完, 只在配置项没有任何历史时用到
+	historyIdle    = time.Second
+	historyTimeout = 10 * time.Second
+	maxConfigDiffs = 100
+)
+
+// ConfigRevision 配置项的一个历史版本
+type ConfigRevision struct {
+	Key string `json:"key"`
+	// Revision 修改时 etcd 的 revision, 可以用于 DiffConfig 和 RollbackConfig
+	Revision int64 `json:"revision"`
+	// Version 配置项从创建开始的修改次数, 删除时为 0
+	Version int64  `json:"version"`
+	Value   string `json:"value"`
+	Deleted bool   `json:"deleted"`
+}
+
+// ConfigDiff 配置项两个版本之间的差异
+type ConfigDiff struct {
+	Key  string `json:"key"`
+	From int64  `json:"from"`
+	To   int64  `json:"to"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+	// Changes 值为 json 时是变化的字段路径, 如 mysql.addr, 否则为 value
+	Changes []string `json:"changes"`
+}
+
+func (e *DB) configKey(key string) string {
+	return e.ConfigInfo.Prefix + strings.TrimLeft(key, "/")
+}
+
+// GetConfigHistory 配置项的修改历史, 按 revision 从旧到新排列, 包括删除记录.
+// key 为 ConfigInfo.Prefix 下的相对路径, 需要先调用 Configuring. 历史来自 etcd 的 MVCC 记录, 被压缩(compact)的部分无法获取.
+func (e *DB) GetConfigHistory(key string) ([]ConfigRevision, error) {
+	fullKey := e.configKey(key)
+	ctx, cancel := context.WithTimeout(context.Background(), historyTimeout)
+	defer cancel()
+
+	resp, err := e.client.Get(ctx, fullKey)
+	if err != nil {
+		return nil, err
+	}
+	// 配置项存在时读到最后一次修改为止, 否则读到当前 revision 为止, 最后一条是删除记录
+	last := resp.Header.Revision
+	if len(resp.Kvs) > 0 {
+		last = resp.Kvs[0].ModRevision
+	}
+
+	ret := make([]ConfigRevision, 0)
+	start := int64(1)
+	for {
+		done, compacted, err := e.replayHistory(ctx, fullKey, key, start, last, &ret)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			return ret, nil
+		}
+		// 早期的历史已经被压缩, 从压缩后的位置重新读取
+		ret = ret[:0]
+		start = compacted
+	}
+}
+
+// replayHistory 从 start 开始重放配置项的修改事件, 历史被压缩时返回可以读取的最小 revision
+func (e *DB) replayHistory(ctx context.Context, fullKey, key string, start, last int64, ret *[]ConfigRevision) (done bool, compacted int64, err error) {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rch := e.client.Watch(wctx, fullKey, clientV3.WithRev(start))
+	idle := time.NewTimer(historyIdle)
+	defer idle.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false, 0, errno.Wrapf(ctx.Err(), "read history of %s err", key)
+		case <-idle.C:
+			return true, 0, nil
+		case wresp, ok := <-rch:
+			if !ok {
+				return true, 0, nil
+			}
+			if wresp.CompactRevision != 0 {
+				return false, wresp.CompactRevision, nil
+			}
+			if err = wresp.Err(); err != nil {
+				return false, 0, err
+			}
+			for _, ev := range wresp.Events {
+				if ev.Kv.ModRevision > last {
+					return true, 0, nil
+				}
+				*ret = append(*ret, ConfigRevision{
+					Key:      key,
+					Revision: ev.Kv.ModRevision,
+					Version:  ev.Kv.Version,
+					Value:    string(ev.Kv.Value),
+					Deleted:  ev.Type == mvccpb.DELETE,
+				})
+				if ev.Kv.ModRevision == last {
+					return true, 0, nil
+				}
+			}
+			// 配置项已删除时, 历史一定以删除记录结束, 读到删除记录并且响应已经到了目标 revision 就不用等到没有新的事件.
+			// 最后一条不是删除记录说明历史还没有发送完
+			if n := len(*ret); wresp.Header.Revision >= last && n > 0 && (*ret)[n-1].Deleted {
+				return true, 0, nil
+			}
+			idle.Reset(historyIdle)
+		}
+	}
+}
+
+// configAt 配置项在 revision 时的值, 不存在时 exists 为 false
+func (e *DB) configAt(fullKey string, revision int64) (value []byte, exists bool, err error) {
+	ctx, cancel := e.TimeOutCtx(10)
+	defer cancel()
+	resp, err := e.client.Get(ctx, fullKey, clientV3.WithRev(revision))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, false, nil
+	}
+	return resp.Kvs[0].Value, true, nil
+}
+
+// DiffConfig 对比配置项在两个 revision 时的值
+func (e *DB) DiffConfig(key string, from, to int64) (*ConfigDiff, error) {
+	fullKey := e.configKey(key)
+	old, _, err := e.configAt(fullKey, from)
+	if err != nil {
+		return nil, errno.Wrapf(err, "get %s at revision %d err", key, from)
+	}
+	val, _, err := e.configAt(fullKey, to)
+	if err != nil {
+		return nil, errno.Wrapf(err, "get %s at revision %d err", key, to)
+	}
+	return &ConfigDiff{Key: key, From: from, To: to, Old: string(old), New: string(val), Changes: diffConfigValue(old, val)}, nil
+}
+
+// RollbackConfig 把配置项恢复到 revision 时的值, 那时配置项不存在则删除. 回滚本身也是一次修改, 会记录到历史和审计日志中
+func (e *DB) RollbackConfig(key string, revision int64) error {
+	fullKey := e.configKey(key)
+	old, exists, err := e.configAt(fullKey, revision)
+	if err != nil {
+		return errno.Wrapf(err, "get %s at revision %d err", key, revision)
+	}
+	ctx, cancel := e.TimeOutCtx(10)
+	defer cancel()
+	var cur []byte
+	var rev int64
+	if exists {
+		var put *clientV3.PutResponse
+		if put, err = e.client.Put(ctx, fullKey, string(old), clientV3.WithPrevKV()); err == nil {
+			rev = put.Header.Revision
+			if put.PrevKv != nil {
+				cur = put.PrevKv.Value
+			}
+		}
+	} else {
+		var del *clientV3.DeleteResponse
+		if del, err = e.client.Delete(ctx, fullKey, clientV3.WithPrevKV()); err == nil {
+			rev = del.Header.Revision
+			if len(del.PrevKvs) > 0 {
+				cur = del.PrevKvs[0].Value
+			}
+		}
+	}
+	if err != nil {
+		return errno.Wrapf(err, "rollback %s to revision %d err", key, revision)
+	}
+	operator, _ := os.Hostname()
+	e.Logger.Info("配置回滚", zap.String("key", key), zap.Int64("to revision", revision), zap.Int64("revision", rev),
+		zap.ByteString("old", cur), zap.ByteString("new", old), zap.Bool("deleted", !exists), zap.String("operator", operator))
+	return nil
+}
+
+// diffConfigValue 值都是 json 时返回变化的字段路径, 否则值不同时返回 value
+func diffConfigValue(old, val []byte) []string {
+	var a, b interface{}
+	if json.Unmarshal(old, &a) != nil || json.Unmarshal(val, &b) != nil {
+		if string(old) != string(val) {
+			return []string{"value"}
+		}
+		return nil
+	}
+	diffs := make([]string, 0)
+	diffJSONValue(a, b, "", &diffs)
+	return diffs
+}
+
+func diffJSONValue(a, b interface{}, path string, diffs *[]string) {
+	if len(*diffs) >= maxConfigDiffs {
+		return
+	}
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	if aok && bok {
+		keys := make([]string, 0, len(am)+len(bm))
+		for k := range am {
+			keys = append(keys, k)
+		}
+		for k := range bm {
+			if _, ok := am[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			diffJSONValue(am[k], bm[k], p, diffs)
+		}
+		return
+	}
+	al, aok := a.([]interface{})
+	bl, bok := b.([]interface{})
+	if aok && bok && len(al) == len(bl) {
+		for i := range al {
+			diffJSONValue(al[i], bl[i], fmt.Sprintf("%s[%d]", path, i), diffs)
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		if path == "" {
+			path = "value"
+		}
+		*diffs = append(*diffs, path)
+	}
+}
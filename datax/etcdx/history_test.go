@@ -0,0 +1,121 @@
+package etcdx
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientV3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+func TestDiffConfigValue(t *testing.T) {
+	cases := []struct {
+		old, new string
+		want     []string
+	}{
+		{`{"mysql":{"addr":"a","pool":1},"debug":true}`, `{"mysql":{"addr":"b","pool":1},"level":"info"}`, []string{"debug", "level", "mysql.addr"}},
+		{`[1,2]`, `[1,3]`, []string{"[1]"}},
+		{`007`, `7`, []string{"value"}},
+		{`{"a":1}`, `{ "a": 1 }`, nil},
+		{`abc`, `abd`, []string{"value"}},
+		{`abc`, `abc`, nil},
+	}
+	for _, c := range cases {
+		got := diffConfigValue([]byte(c.old), []byte(c.new))
+		if len(got) == 0 && len(c.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("diff %s -> %s got %v, want %v", c.old, c.new, got, c.want)
+		}
+	}
+}
+
+func TestConfWatcherDelete(t *testing.T) {
+	e := &DB{configListing: make(ConfigStringMap), Logger: zap.NewNop(), ConfigInfo: ConfigInfo{Prefix: "/Config/dev/test/"}}
+	kv := &mvccpb.KeyValue{Key: []byte("/Config/dev/test/limit"), Value: []byte("10"), Version: 1}
+	confWatcher(e, clientV3.WatchResponse{Events: []*clientV3.Event{{Type: mvccpb.PUT, Kv: kv}}})
+	if e.GetConfigs()["limit"] != 10 {
+		t.Fatalf("put not applied: %v", e.GetConfigs())
+	}
+	confWatcher(e, clientV3.WatchResponse{Events: []*clientV3.Event{{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: kv.Key}, PrevKv: kv}}})
+	if _, ok := e.GetConfigs()["limit"]; ok {
+		t.Fatalf("deleted config should be removed: %v", e.GetConfigs())
+	}
+}
+
+// historyKV 只实现 Get, 返回固定的结果
+type historyKV struct {
+	clientV3.KV
+	resp *clientV3.GetResponse
+}
+
+func (kv historyKV) Get(context.Context, string, ...clientV3.OpOption) (*clientV3.GetResponse, error) {
+	return kv.resp, nil
+}
+
+// historyWatcher 依次发送 responses, 之后保持打开, 与真实的 watch 一样不会自己结束
+type historyWatcher struct {
+	clientV3.Watcher
+	responses []clientV3.WatchResponse
+}
+
+func (w historyWatcher) Watch(_ context.Context, _ string, _ ...clientV3.OpOption) clientV3.WatchChan {
+	ch := make(chan clientV3.WatchResponse, len(w.responses))
+	for _, resp := range w.responses {
+		ch <- resp
+	}
+	return ch
+}
+
+func TestGetConfigHistoryDeleted(t *testing.T) {
+	key := []byte("/Config/dev/test/limit")
+	event := func(typ mvccpb.Event_EventType, rev, version int64, val string) *clientV3.Event {
+		return &clientV3.Event{Type: typ, Kv: &mvccpb.KeyValue{Key: key, Value: []byte(val), ModRevision: rev, Version: version}}
+	}
+	// 历史事件分多批发送时, 最后一条不是删除记录不能提前结束
+	batch := make([]*clientV3.Event, 0, 3)
+	for i := 1; i <= 3; i++ {
+		batch = append(batch, event(mvccpb.PUT, int64(i), int64(i), fmt.Sprint(i)))
+	}
+	cases := []struct {
+		name      string
+		responses []clientV3.WatchResponse
+		want      int
+	}{
+		{"deleted", []clientV3.WatchResponse{{
+			Header: pb.ResponseHeader{Revision: 2000},
+			Events: []*clientV3.Event{event(mvccpb.PUT, 3, 1, "10"), event(mvccpb.DELETE, 7, 0, "")},
+		}}, 2},
+		{"batches", []clientV3.WatchResponse{
+			{Header: pb.ResponseHeader{Revision: 2000}, Events: batch},
+			{Header: pb.ResponseHeader{Revision: 2000}, Events: []*clientV3.Event{event(mvccpb.DELETE, 1500, 0, "")}},
+		}, 4},
+	}
+	for _, c := range cases {
+		e := &DB{
+			ConfigInfo: ConfigInfo{Prefix: "/Config/dev/test/"},
+			Logger:     zap.NewNop(),
+			client: &clientV3.Client{
+				KV:      historyKV{resp: &clientV3.GetResponse{Header: &pb.ResponseHeader{Revision: 1800}}},
+				Watcher: historyWatcher{responses: c.responses},
+			},
+		}
+		ts := time.Now()
+		ret, err := e.GetConfigHistory("limit")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ret) != c.want || !ret[len(ret)-1].Deleted {
+			t.Fatalf("%s: got %d revisions, want %d", c.name, len(ret), c.want)
+		}
+		if cost := time.Since(ts); cost >= historyIdle {
+			t.Errorf("%s: history of deleted key waited for idle timeout: %s", c.name, cost)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package etcdx
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientV3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+// watchRetryInterval 监听中断后重新读取失败时, 等待多久再试
+const watchRetryInterval = time.Second
+
+// watchFrom 从 rev 开始监听 prefix, 直到 ctx 取消. 监听的版本被压缩或者监听出错中断时,
+// 调用 reload 重新读取当前的配置, 从返回的版本的下一个版本继续监听, 中间的变更由 reload 负责补上.
+func (e *DB) watchFrom(ctx context.Context, prefix string, rev int64, watcherFunc WatcherFunc, reload func() (int64, error)) {
+	for {
+		e.WatcherWithContext(ctx, prefix, func(repo Repo, wresp clientV3.WatchResponse) {
+			if err := wresp.Err(); err != nil {
+				e.Logger.Warn("监听中断, 重新读取后继续监听", zap.String("prefix", prefix),
+					zap.Int64("compactRevision", wresp.CompactRevision), zap.Error(err))
+				return
+			}
+			watcherFunc(repo, wresp)
+		}, clientV3.WithRev(rev))
+
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+			// 客户端已经关闭
+			if c := e.client.Ctx(); c != nil && c.Err() != nil {
+				return
+			}
+			r, err := reload()
+			if err == nil {
+				rev = r + 1
+				break
+			}
+			e.Logger.Error("重新读取配置失败", zap.String("prefix", prefix), zap.Error(err))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(watchRetryInterval):
+			}
+		}
+	}
+}
+
+// WatchKey 读取 ConfigInfo.Prefix 下的单个配置项 key, 并从读取时的下一个版本开始监听变更, 返回停止监听的函数.
+// 读取到的值和之后的每次变更都会调用 fn, 配置被删除时 value 为 nil; 读取时配置不存在则不调用.
+// 读取时 fn 返回错误则 WatchKey 返回该错误, 变更时 fn 返回错误只记录日志, 由 fn 自己决定是否保留原来的值.
+func WatchKey(repo Repo, key string, fn func(value []byte) error) (stop func(), err error) {
+	db := repo.GetRepo()
+	fullKey := db.ConfigInfo.Prefix + strings.TrimLeft(key, "/")
+	exists := false
+	apply := func(value []byte, deleted bool) {
+		if deleted && !exists {
+			return
+		}
+		exists = !deleted
+		if err := fn(value); err != nil {
+			db.Logger.Error("配置不合法", zap.String("key", fullKey), zap.ByteString("value", value), zap.Error(err))
+			return
+		}
+		db.Logger.Info("配置更新", zap.String("key", fullKey), zap.ByteString("value", value), zap.Bool("deleted", deleted))
+	}
+	get := func() (*clientV3.GetResponse, error) {
+		ctx, cancel := repo.TimeOutCtx(10)
+		defer cancel()
+		return repo.GetConn().Get(ctx, fullKey)
+	}
+
+	resp, err := get()
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) > 0 {
+		if err = fn(resp.Kvs[0].Value); err != nil {
+			return nil, err
+		}
+		exists = true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reload := func() (int64, error) {
+		resp, err := get()
+		if err != nil {
+			return 0, err
+		}
+		if len(resp.Kvs) > 0 {
+			apply(resp.Kvs[0].Value, false)
+		} else {
+			apply(nil, true)
+		}
+		return resp.Header.Revision, nil
+	}
+	go db.watchFrom(ctx, fullKey, resp.Header.Revision+1, func(_ Repo, wresp clientV3.WatchResponse) {
+		for _, ev := range wresp.Events {
+			// 监听使用的是前缀, 跳过其它配置项
+			if string(ev.Kv.Key) != fullKey {
+				continue
+			}
+			switch ev.Type {
+			case mvccpb.PUT:
+				apply(ev.Kv.Value, false)
+			case mvccpb.DELETE:
+				apply(nil, true)
+			}
+		}
+	}, reload)
+	return cancel, nil
+}
@@ -0,0 +1,118 @@
+package etcdx
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientV3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+// scriptKV 每次 Get 依次返回 responses 中的一个, 用完后一直返回最后一个
+type scriptKV struct {
+	clientV3.KV
+	mu        sync.Mutex
+	responses []*clientV3.GetResponse
+}
+
+func (kv *scriptKV) Get(context.Context, string, ...clientV3.OpOption) (*clientV3.GetResponse, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	resp := kv.responses[0]
+	if len(kv.responses) > 1 {
+		kv.responses = kv.responses[1:]
+	}
+	return resp, nil
+}
+
+// scriptWatcher 每次 Watch 依次发送 rounds 中的一组响应, 除了最后一组之外发送完就关闭, 模拟监听中断
+type scriptWatcher struct {
+	clientV3.Watcher
+	mu     sync.Mutex
+	rounds [][]clientV3.WatchResponse
+	revs   []int64
+}
+
+func (w *scriptWatcher) Watch(ctx context.Context, key string, opts ...clientV3.OpOption) clientV3.WatchChan {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	op := clientV3.OpGet(key, opts...)
+	w.revs = append(w.revs, op.Rev())
+	ch := make(chan clientV3.WatchResponse, 10)
+	if len(w.rounds) == 0 {
+		go func() {
+			<-ctx.Done()
+			close(ch)
+		}()
+		return ch
+	}
+	for _, resp := range w.rounds[0] {
+		ch <- resp
+	}
+	w.rounds = w.rounds[1:]
+	close(ch)
+	return ch
+}
+
+func (w *scriptWatcher) watchRevs() []int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]int64(nil), w.revs...)
+}
+
+func TestWatchKey(t *testing.T) {
+	key := []byte("/Config/dev/test/routes")
+	kv := func(val string) *mvccpb.KeyValue {
+		return &mvccpb.KeyValue{Key: key, Value: []byte(val)}
+	}
+	kvs := &scriptKV{responses: []*clientV3.GetResponse{
+		{Header: &pb.ResponseHeader{Revision: 10}, Kvs: []*mvccpb.KeyValue{kv("a")}},
+		// 压缩之后重新读取, 配置已经被删除
+		{Header: &pb.ResponseHeader{Revision: 30}},
+	}}
+	watcher := &scriptWatcher{rounds: [][]clientV3.WatchResponse{{
+		{Events: []*clientV3.Event{{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte("/Config/dev/test/routes2"), Value: []byte("x")}}}},
+		{Events: []*clientV3.Event{{Type: mvccpb.PUT, Kv: kv("b")}}},
+		{CompactRevision: 20, Canceled: true, Header: pb.ResponseHeader{Revision: 25}},
+	}}}
+	e := &DB{
+		ConfigInfo: ConfigInfo{Prefix: "/Config/dev/test/"},
+		Logger:     zap.NewNop(),
+		client:     &clientV3.Client{KV: kvs, Watcher: watcher},
+	}
+
+	var mu sync.Mutex
+	values := make([]string, 0)
+	stop, err := WatchKey(e, "routes", func(value []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if value == nil {
+			values = append(values, "<deleted>")
+		} else {
+			values = append(values, string(value))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	deadline := time.Now().Add(time.Second)
+	for len(watcher.watchRevs()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	revs := watcher.watchRevs()
+	if len(revs) != 2 || revs[0] != 11 || revs[1] != 31 {
+		t.Fatalf("watch revisions = %v, want [11 31]", revs)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(values) != 3 || values[0] != "a" || values[1] != "b" || values[2] != "<deleted>" {
+		t.Fatalf("values = %v", values)
+	}
+}
@@ -0,0 +1,208 @@
+package gormx
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/httpx/mux"
+	"github.com/chenxinqun/ginWarpPkg/httpx/trace"
+	"github.com/chenxinqun/ginWarpPkg/loggerx"
+	"github.com/chenxinqun/ginWarpPkg/metrics"
+	"github.com/chenxinqun/ginWarpPkg/sysx/environment"
+	"github.com/chenxinqun/ginWarpPkg/timex"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	callBackBeforeName = "trace:before"
+	callBackAfterName  = "trace:after"
+	startTime          = "_start_time"
+
+	// DefaultSlowThreshold 默认慢查询阈值, 单位毫秒
+	DefaultSlowThreshold = 500
+)
+
+var pluginSourceDir string
+
+func init() {
+	_, file, _, _ := runtime.Caller(0)
+	pluginSourceDir = filepath.Dir(file)
+}
+
+// Config 插件配置
+type Config struct {
+	// Name 数据库名称, 用于指标和日志区分不同的数据库
+	Name string
+	// SlowThreshold 慢查询阈值, 单位毫秒, 不填有默认值
+	SlowThreshold int
+}
+
+// TracePlugin mysql, postgresql, sqlite, clickhouse 共用的观测插件.
+// 记录 trace.SQL, 慢查询日志(非生产环境附带 EXPLAIN), 以及 prometheus 的查询和连接池指标.
+type TracePlugin struct {
+	name          string
+	slowThreshold time.Duration
+}
+
+var _ gorm.Plugin = (*TracePlugin)(nil)
+
+func NewPlugin(cfg Config) *TracePlugin {
+	if cfg.SlowThreshold <= 0 {
+		cfg.SlowThreshold = DefaultSlowThreshold
+	}
+	return &TracePlugin{
+		name:          cfg.Name,
+		slowThreshold: time.Duration(cfg.SlowThreshold) * time.Millisecond,
+	}
+}
+
+func (p *TracePlugin) Name() string {
+	return "tracePlugin"
+}
+
+func (p *TracePlugin) Initialize(db *gorm.DB) (err error) {
+	if p.slowThreshold <= 0 {
+		p.slowThreshold = DefaultSlowThreshold * time.Millisecond
+	}
+	if p.name == "" {
+		p.name = db.Dialector.Name()
+	}
+
+	// 开始前
+	_ = db.Callback().Create().Before("gorm:before_create").Register(callBackBeforeName, before)
+	_ = db.Callback().Query().Before("gorm:query").Register(callBackBeforeName, before)
+	_ = db.Callback().Delete().Before("gorm:before_delete").Register(callBackBeforeName, before)
+	_ = db.Callback().Update().Before("gorm:setup_reflect_value").Register(callBackBeforeName, before)
+	_ = db.Callback().Row().Before("gorm:row").Register(callBackBeforeName, before)
+	_ = db.Callback().Raw().Before("gorm:raw").Register(callBackBeforeName, before)
+
+	// 结束后
+	_ = db.Callback().Create().After("gorm:after_create").Register(callBackAfterName, p.after("create"))
+	_ = db.Callback().Query().After("gorm:after_query").Register(callBackAfterName, p.after("query"))
+	_ = db.Callback().Delete().After("gorm:after_delete").Register(callBackAfterName, p.after("delete"))
+	_ = db.Callback().Update().After("gorm:after_update").Register(callBackAfterName, p.after("update"))
+	_ = db.Callback().Row().After("gorm:row").Register(callBackAfterName, p.after("row"))
+	_ = db.Callback().Raw().After("gorm:raw").Register(callBackAfterName, p.after("raw"))
+
+	// 连接池指标
+	if sqlDB, e := db.DB(); e == nil {
+		if e = metrics.RegisterDBStats(p.name, sqlDB.Stats); e != nil && loggerx.Default() != nil {
+			loggerx.Default().Warn("注册数据库连接池指标失败", zap.String("db", p.name), zap.Error(e))
+		}
+	}
+	return
+}
+
+func before(db *gorm.DB) {
+	db.InstanceSet(startTime, time.Now())
+}
+
+func (p *TracePlugin) after(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		_ts, isExist := db.InstanceGet(startTime)
+		if !isExist {
+			return
+		}
+		ts, ok := _ts.(time.Time)
+		if !ok {
+			return
+		}
+		cost := time.Since(ts)
+		success := db.Error == nil || errors.Is(db.Error, gorm.ErrRecordNotFound)
+		metrics.RecordSQLMetrics(p.name, operation, db.Statement.Table, success, cost.Seconds())
+
+		rawSQL := db.Statement.SQL.String()
+		if rawSQL == "" {
+			return
+		}
+		sql := db.Dialector.Explain(rawSQL, db.Statement.Vars...)
+		stack := fileWithLineNum()
+
+		if cost >= p.slowThreshold {
+			p.slowLog(db, sql, stack, cost)
+		}
+
+		t := traceFromContext(db.Statement.Context)
+		if t == nil {
+			return
+		}
+		sqlInfo := new(trace.SQL)
+		sqlInfo.Timestamp = timex.CSTLayoutString()
+		sqlInfo.SQL = sql
+		sqlInfo.Stack = stack
+		sqlInfo.Rows = db.Statement.RowsAffected
+		sqlInfo.CostSeconds = cost.Seconds()
+		t.AppendSQL(sqlInfo)
+	}
+}
+
+// slowLog 打印慢查询日志, 非生产环境下附带查询语句的执行计划
+func (p *TracePlugin) slowLog(db *gorm.DB, sql, stack string, cost time.Duration) {
+	logger := loggerx.Default()
+	if logger == nil {
+		return
+	}
+	fields := []zap.Field{
+		zap.String("db", p.name),
+		zap.String("sql", sql),
+		zap.String("stack", stack),
+		zap.Int64("rows_affected", db.Statement.RowsAffected),
+		zap.Float64("cost_seconds", cost.Seconds()),
+		zap.Error(db.Error),
+	}
+	if active := environment.Active(); active == nil || !active.IsPro() {
+		if plan, err := explain(db); err != nil {
+			fields = append(fields, zap.NamedError("explain_error", err))
+		} else if plan != nil {
+			fields = append(fields, zap.Any("explain", plan))
+		}
+	}
+	logger.Warn("sql慢查询", fields...)
+}
+
+// explain 获取查询语句的执行计划, 只对 SELECT 语句生效
+func explain(db *gorm.DB) ([]map[string]interface{}, error) {
+	rawSQL := strings.TrimSpace(db.Statement.SQL.String())
+	if !strings.HasPrefix(strings.ToUpper(rawSQL), "SELECT") {
+		return nil, nil
+	}
+	prefix := "EXPLAIN "
+	if db.Dialector.Name() == "sqlite" {
+		prefix = "EXPLAIN QUERY PLAN "
+	}
+	plan := make([]map[string]interface{}, 0)
+	tx := db.Session(&gorm.Session{NewDB: true, Context: context.Background()})
+	err := tx.Raw(prefix+rawSQL, db.Statement.Vars...).Scan(&plan).Error
+	return plan, err
+}
+
+// traceFromContext 从 context 中获取 trace
+func traceFromContext(ctx context.Context) *trace.Trace {
+	t, _ := mux.TraceFromContext(ctx).(*trace.Trace)
+	return t
+}
+
+// fileWithLineNum 获取业务代码中发起查询的位置, 跳过 gorm 和本插件的调用栈
+func fileWithLineNum() string {
+	for i := 2; i < 20; i++ {
+		_, file, line, ok := runtime.Caller(i)
+		if !ok {
+			break
+		}
+		if strings.HasSuffix(file, "_test.go") {
+			return file + ":" + strconv.Itoa(line)
+		}
+		if strings.Contains(file, "gorm.io/") || strings.HasPrefix(file, pluginSourceDir) {
+			continue
+		}
+		return file + ":" + strconv.Itoa(line)
+	}
+	return ""
+}
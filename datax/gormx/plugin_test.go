@@ -0,0 +1,64 @@
+package gormx
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/chenxinqun/ginWarpPkg/httpx/mux"
+	"github.com/chenxinqun/ginWarpPkg/httpx/trace"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+type user struct {
+	ID   int64  `gorm:"column:id"`
+	Name string `gorm:"column:name"`
+}
+
+func TestTracePlugin(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Use(NewPlugin(Config{Name: "sqlite/test"})); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&user{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := trace.New("")
+	ctx := &mux.StdContext{Context: context.Background(), Trace: tr}
+	if err = db.WithContext(ctx).Create(&user{ID: 1, Name: "a"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	ret := make([]user, 0)
+	if err = db.WithContext(*ctx).Where("name = ?", "a").Find(&ret).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tr.SQLs) != 2 {
+		t.Fatalf("want 2 sql records, got %d", len(tr.SQLs))
+	}
+	if !strings.Contains(tr.SQLs[1].SQL, "name = \"a\"") {
+		t.Errorf("sql not recorded: %s", tr.SQLs[1].SQL)
+	}
+	if tr.SQLs[0].Rows != 1 {
+		t.Errorf("want 1 row affected, got %d", tr.SQLs[0].Rows)
+	}
+	for _, s := range tr.SQLs {
+		if !strings.Contains(s.Stack, "plugin_test.go") {
+			t.Errorf("caller should be the test file, got %s", s.Stack)
+		}
+	}
+
+	// 没有 trace 的 context 不应该被记录
+	if err = db.WithContext(context.Background()).Find(&ret).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.SQLs) != 2 {
+		t.Fatalf("want 2 sql records, got %d", len(tr.SQLs))
+	}
+}
@@ -97,29 +97,54 @@ func (p *AsyncProducer) Close() error {
 }
 
 func (p *AsyncProducer) SendMessage(topic Topic, key string, value interface{}) (msg *ProducerMessage, err error) {
+	return p.SendMessageWithOptions(topic, key, value)
+}
+
+func (p *AsyncProducer) SendMessageByte(topic Topic, key string, value []byte) (msg *ProducerMessage, err error) {
+	return p.SendMessageByteWithOptions(topic, key, value)
+}
+
+// SendMessageWithOptions 同 SendMessage, 传入 WithTrace 时, 会把链路ID写入消息头, 并记录 trace.Kafka
+func (p *AsyncProducer) SendMessageWithOptions(topic Topic, key string, value interface{}, options ...OptionHandler) (msg *ProducerMessage, err error) {
 	var byteVal []byte
 	byteVal, err = convert.StructToJSON(value)
 	if err != nil {
 		return nil, err
 	}
-	msg, err = p.SendMessageByte(topic, key, byteVal)
-	return msg, nil
+	msg, err = p.SendMessageByteWithOptions(topic, key, byteVal, options...)
+	return msg, err
 }
 
-func (p *AsyncProducer) SendMessageByte(topic Topic, key string, value []byte) (msg *ProducerMessage, err error) {
+func (p *AsyncProducer) SendMessageByteWithOptions(topic Topic, key string, value []byte, options ...OptionHandler) (msg *ProducerMessage, err error) {
+	ts := time.Now()
+	opt := newOption(options...)
 	m := &sarama.ProducerMessage{
 		Topic: topic.String(),
 		Key:   sarama.StringEncoder(key),
 		Value: sarama.ByteEncoder(value),
 	}
+	// 异步模式下 partition 和 offset 要在 Successes 中才能拿到, 这里只记录投递动作.
+	// 投递之后 m 由 sarama 的协程修改, 需要在投递之前复制一份
+	spanID := injectTraceHeaders(m, opt.Trace)
+	msg = &ProducerMessage{*m}
 	// TODO ctx, close的情况.
 	p.Client.Input() <- m
-	msg = &ProducerMessage{*m}
+	appendProduceTrace(opt.Trace, opt.Kafka, &msg.ProducerMessage, spanID, ts, nil)
 	return msg, nil
 }
 
 func (p *AsyncProducer) SendMessages(topic Topic,
 	key string, values ...interface{}) (msgList []*ProducerMessage, err error) {
+	return p.SendMessagesWithOptions(topic, key, values)
+}
+
+func (p *AsyncProducer) SendMessagesByte(topic Topic, key string, values ...[]byte) (msgList []*ProducerMessage, err error) {
+	return p.SendMessagesByteWithOptions(topic, key, values)
+}
+
+// SendMessagesWithOptions 同 SendMessages, 传入 WithTrace 时, 每条消息都会写入链路ID并记录 trace.Kafka
+func (p *AsyncProducer) SendMessagesWithOptions(topic Topic,
+	key string, values []interface{}, options ...OptionHandler) (msgList []*ProducerMessage, err error) {
 	mList := make([][]byte, 0)
 	for _, value := range values {
 		var byteVal []byte
@@ -129,13 +154,15 @@ func (p *AsyncProducer) SendMessages(topic Topic,
 		}
 		mList = append(mList, byteVal)
 	}
-	msgList, err = p.SendMessagesByte(topic, key, mList...)
+	msgList, err = p.SendMessagesByteWithOptions(topic, key, mList, options...)
 
-	return msgList, nil
+	return msgList, err
 }
 
-func (p *AsyncProducer) SendMessagesByte(topic Topic, key string, values ...[]byte) (msgList []*ProducerMessage, err error) {
+func (p *AsyncProducer) SendMessagesByteWithOptions(topic Topic, key string, values [][]byte, options ...OptionHandler) (msgList []*ProducerMessage, err error) {
+	opt := newOption(options...)
 	for _, value := range values {
+		ts := time.Now()
 		if msgList == nil {
 			msgList = make([]*ProducerMessage, 0)
 		}
@@ -144,8 +171,10 @@ func (p *AsyncProducer) SendMessagesByte(topic Topic, key string, values ...[]by
 			Key:   sarama.StringEncoder(key),
 			Value: sarama.ByteEncoder(value),
 		}
-		p.Client.Input() <- m
+		spanID := injectTraceHeaders(m, opt.Trace)
 		msg := &ProducerMessage{*m}
+		p.Client.Input() <- m
+		appendProduceTrace(opt.Trace, nil, &msg.ProducerMessage, spanID, ts, nil)
 		msgList = append(msgList, msg)
 	}
 	return msgList, nil
@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
+	"github.com/chenxinqun/ginWarpPkg/httpx/mux"
 	"github.com/chenxinqun/ginWarpPkg/loggerx"
 	"go.uber.org/zap"
 
@@ -114,7 +116,7 @@ func (g *ConsumerGroup) GetClient() *ConsumerGroup {
 	return g
 }
 
-func (g *ConsumerGroup) initHandler(t []string, handler ConsumeGroupHandler) *consumerGroupHandler {
+func (g *ConsumerGroup) initHandler(t []string, handler ConsumeGroupTraceHandler) *consumerGroupHandler {
 	h := newConsumerGroupHandler(handler)
 	h.topics = t
 	h.version = g.info.Version
@@ -125,6 +127,13 @@ func (g *ConsumerGroup) initHandler(t []string, handler ConsumeGroupHandler) *co
 
 // Consume 消费者, 这个是一个阻塞的动作. 应该包裹在一个for循环中. for循环结束记得调用cancel.
 func (g *ConsumerGroup) Consume(topics []Topic, handler ConsumeGroupHandler) error {
+	return g.ConsumeWithTrace(topics, func(_ *mux.StdContext, msg *ConsumerMessage) (error, bool) {
+		return handler(msg)
+	})
+}
+
+// ConsumeWithTrace 同 Consume, 每条消息都会从消息头延续链路, 通过 ctx 传给消费函数, 消费结束后打印链路日志.
+func (g *ConsumerGroup) ConsumeWithTrace(topics []Topic, handler ConsumeGroupTraceHandler) error {
 	var client sarama.ConsumerGroup
 	t := make([]string, len(topics))
 	for i := 0; i < len(t); i++ {
@@ -198,7 +207,7 @@ type ConsumerGroupHandler interface {
 }
 
 type consumerGroupHandler struct {
-	handler            ConsumeGroupHandler
+	handler            ConsumeGroupTraceHandler
 	topics             []string
 	channameBufferSize int
 	version            string
@@ -207,7 +216,7 @@ type consumerGroupHandler struct {
 	Stop               bool
 }
 
-func newConsumerGroupHandler(handler ConsumeGroupHandler) *consumerGroupHandler {
+func newConsumerGroupHandler(handler ConsumeGroupTraceHandler) *consumerGroupHandler {
 	return &consumerGroupHandler{handler: handler}
 }
 
@@ -240,8 +249,11 @@ func (h *consumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, cl
 			e    error
 			mark bool
 		)
+		ts := time.Now()
+		ctx := newConsumeContext(m)
 		msg := &ConsumerMessage{m}
-		e, mark = h.handler(msg)
+		e, mark = h.handler(ctx, msg)
+		afterConsume(ctx, e, ts)
 		if mark {
 			sess.MarkMessage(m, "")
 		}
@@ -4,6 +4,7 @@ import (
 	"github.com/Shopify/sarama"
 	"github.com/chenxinqun/ginWarpPkg/convert"
 	"strconv"
+	"time"
 )
 
 type Producer struct {
@@ -73,21 +74,36 @@ func (p *Producer) GetClient() *Producer {
 
 // SendMessage 发送一条消息, 返回一个消息指针. 关注 msg.PartitionConsumer, msg.Offset 两个变量.
 func (p *Producer) SendMessage(topic Topic, key string, value interface{}) (msg *ProducerMessage, err error) {
+	return p.SendMessageWithOptions(topic, key, value)
+}
+
+func (p *Producer) SendMessageByte(topic Topic, key string, value []byte) (msg *ProducerMessage, err error) {
+	return p.SendMessageByteWithOptions(topic, key, value)
+}
+
+// SendMessageWithOptions 同 SendMessage, 传入 WithTrace 时, 会把链路ID写入消息头, 并记录 trace.Kafka
+func (p *Producer) SendMessageWithOptions(topic Topic, key string, value interface{}, options ...OptionHandler) (msg *ProducerMessage, err error) {
 	var byteVal []byte
 	byteVal, err = convert.StructToJSON(value)
 	if err != nil {
 		return
 	}
-	msg, err = p.SendMessageByte(topic, key, byteVal)
-	return msg, nil
+	msg, err = p.SendMessageByteWithOptions(topic, key, byteVal, options...)
+	return msg, err
 }
 
-func (p *Producer) SendMessageByte(topic Topic, key string, value []byte) (msg *ProducerMessage, err error) {
+func (p *Producer) SendMessageByteWithOptions(topic Topic, key string, value []byte, options ...OptionHandler) (msg *ProducerMessage, err error) {
+	ts := time.Now()
+	opt := newOption(options...)
 	m := &sarama.ProducerMessage{
 		Topic: topic.String(),
 		Key:   sarama.StringEncoder(key),
 		Value: sarama.ByteEncoder(value),
 	}
+	spanID := injectTraceHeaders(m, opt.Trace)
+	defer func() {
+		appendProduceTrace(opt.Trace, opt.Kafka, m, spanID, ts, err)
+	}()
 	_, _, err = p.Client.SendMessage(m)
 	if err != nil {
 		return nil, err
@@ -98,7 +114,16 @@ func (p *Producer) SendMessageByte(topic Topic, key string, value []byte) (msg *
 
 // SendMessages 批量发送消息, 返回消息指针数组. 关注 msg.PartitionConsumer, msg.Offset 两个变量.
 func (p *Producer) SendMessages(topic Topic, key string, values ...interface{}) (msgList []*ProducerMessage, err error) {
-	mList := make([][]byte, len(values))
+	return p.SendMessagesWithOptions(topic, key, values)
+}
+
+func (p *Producer) SendMessagesByte(topic Topic, key string, values ...[]byte) (msgList []*ProducerMessage, err error) {
+	return p.SendMessagesByteWithOptions(topic, key, values)
+}
+
+// SendMessagesWithOptions 同 SendMessages, 传入 WithTrace 时, 每条消息都会写入链路ID并记录 trace.Kafka
+func (p *Producer) SendMessagesWithOptions(topic Topic, key string, values []interface{}, options ...OptionHandler) (msgList []*ProducerMessage, err error) {
+	mList := make([][]byte, 0, len(values))
 	for _, value := range values {
 		var byteVal []byte
 		byteVal, err = convert.StructToJSON(value)
@@ -108,20 +133,29 @@ func (p *Producer) SendMessages(topic Topic, key string, values ...interface{})
 
 		mList = append(mList, byteVal)
 	}
-	msgList, err = p.SendMessagesByte(topic, key, mList...)
+	msgList, err = p.SendMessagesByteWithOptions(topic, key, mList, options...)
 	return msgList, err
 }
 
-func (p *Producer) SendMessagesByte(topic Topic, key string, values ...[]byte) (msgList []*ProducerMessage, err error) {
+func (p *Producer) SendMessagesByteWithOptions(topic Topic, key string, values [][]byte, options ...OptionHandler) (msgList []*ProducerMessage, err error) {
+	ts := time.Now()
+	opt := newOption(options...)
 	mList := make([]*sarama.ProducerMessage, 0)
+	spanIDs := make([]string, 0, len(values))
 	for _, value := range values {
 		msg := &sarama.ProducerMessage{
 			Topic: topic.String(),
 			Key:   sarama.StringEncoder(key),
 			Value: sarama.ByteEncoder(value),
 		}
+		spanIDs = append(spanIDs, injectTraceHeaders(msg, opt.Trace))
 		mList = append(mList, msg)
 	}
+	defer func() {
+		for i, m := range mList {
+			appendProduceTrace(opt.Trace, nil, m, spanIDs[i], ts, err)
+		}
+	}()
 	err = p.Client.SendMessages(mList)
 	if err != nil {
 		return nil, err
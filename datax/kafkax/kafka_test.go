@@ -1,5 +1,14 @@
 package kafkax
 
+import (
+	"testing"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/httpx/trace"
+
+	"github.com/Shopify/sarama"
+)
+
 func getCfg() Info {
 	return Info{ //nolint:exhaustivestruct
 		BrokerList:    []string{"192.168.110.147:9092", "192.168.110.127:9092", "192.168.110.53:9092"},
@@ -38,3 +47,114 @@ func CreateTestConsumerGroup(cfgs ...Info) ConsumerGroupRepo {
 
 	return p
 }
+
+type testTopic string
+
+func (t testTopic) String() string {
+	return string(t)
+}
+
+func TestTraceHeaderRoundTrip(t *testing.T) {
+	tr := trace.New("")
+	m := &sarama.ProducerMessage{Topic: "orders", Key: sarama.StringEncoder("k1")}
+	spanID := injectTraceHeaders(m, tr)
+	if spanID == "" {
+		t.Fatal("span id not generated")
+	}
+	if injectTraceHeaders(&sarama.ProducerMessage{}, nil) != "" {
+		t.Fatal("span id generated without trace")
+	}
+
+	// 模拟 broker 把生产者的消息头原样交给消费者
+	headers := make([]*sarama.RecordHeader, 0, len(m.Headers))
+	for i := range m.Headers {
+		headers = append(headers, &m.Headers[i])
+	}
+	ctx := newConsumeContext(&sarama.ConsumerMessage{Topic: "orders", Key: []byte("k1"), Partition: 2, Offset: 10, Headers: headers})
+	consumed, ok := ctx.Trace.(*trace.Trace)
+	if !ok {
+		t.Fatal("consume context has no trace")
+	}
+	if consumed.TraceID != tr.TraceID {
+		t.Errorf("trace id got %s, want %s", consumed.TraceID, tr.TraceID)
+	}
+	if len(consumed.Kafka) != 1 {
+		t.Fatalf("want 1 consume record, got %d", len(consumed.Kafka))
+	}
+	k := consumed.Kafka[0]
+	if k.SpanID != spanID || k.Handle != "consume" || k.Topic != "orders" || k.Key != "k1" || k.Partition != 2 || k.Offset != 10 {
+		t.Errorf("unexpected consume record: %+v", k)
+	}
+	afterConsume(ctx, nil, time.Now())
+	if ctx.Err() == nil {
+		t.Error("consume context not cancelled")
+	}
+
+	// 没有链路头的消息开启新的链路
+	fresh := newConsumeContext(&sarama.ConsumerMessage{Topic: "orders"})
+	if id := fresh.Trace.ID(); id == "" || id == tr.TraceID {
+		t.Errorf("unexpected trace id for message without headers: %s", id)
+	}
+}
+
+// inputProducer 模拟 sarama 的异步生产者, 收到消息后在另一个协程中回写 partition 和 offset
+type inputProducer struct {
+	sarama.AsyncProducer
+	input chan *sarama.ProducerMessage
+}
+
+func (p *inputProducer) Input() chan<- *sarama.ProducerMessage {
+	return p.input
+}
+
+func TestAsyncProducerTrace(t *testing.T) {
+	stub := &inputProducer{input: make(chan *sarama.ProducerMessage)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var offset int64
+		for m := range stub.input {
+			offset++
+			m.Partition, m.Offset = 1, offset
+		}
+	}()
+	p := &AsyncProducer{Client: stub}
+	tr := trace.New("")
+
+	if _, err := p.SendMessageByteWithOptions(testTopic("orders"), "k1", []byte("v1"), WithTrace(tr)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.SendMessagesByteWithOptions(testTopic("orders"), "k2", [][]byte{[]byte("v2"), []byte("v3")}, WithTrace(tr)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.SendMessagesByte(testTopic("orders"), "k3", []byte("v4")); err != nil {
+		t.Fatal(err)
+	}
+	close(stub.input)
+	<-done
+
+	if len(tr.Kafka) != 3 {
+		t.Fatalf("want 3 produce records, got %d", len(tr.Kafka))
+	}
+	for _, k := range tr.Kafka {
+		if k.Handle != "produce" || k.Topic != "orders" || k.SpanID == "" {
+			t.Errorf("unexpected produce record: %+v", k)
+		}
+	}
+}
+
+// otherTrace 其它 trace.T 的实现
+type otherTrace struct {
+	trace.T
+}
+
+func TestWithTraceOtherImplementation(t *testing.T) {
+	opt := newOption(WithTrace(otherTrace{}), WithTrace(nil))
+	if opt.Trace != nil || opt.Kafka != nil {
+		t.Fatalf("unsupported trace should be ignored: %+v", opt)
+	}
+	tr := trace.New("")
+	if opt = newOption(WithTrace(tr)); opt.Trace != tr || opt.Kafka == nil {
+		t.Fatalf("trace not set: %+v", opt)
+	}
+}
@@ -0,0 +1,127 @@
+package kafkax
+
+import (
+	"context"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/httpx/mux"
+	"github.com/chenxinqun/ginWarpPkg/httpx/trace"
+	"github.com/chenxinqun/ginWarpPkg/loggerx"
+	"github.com/chenxinqun/ginWarpPkg/timex"
+
+	"github.com/Shopify/sarama"
+)
+
+// WithTrace 设置trace信息, 发送消息时会把链路ID写入消息头, 并记录 trace.Kafka. 只支持 *trace.Trace, 其它实现会被忽略
+func WithTrace(t Trace) OptionHandler {
+	return func(opt *option) {
+		if x, ok := t.(*trace.Trace); ok && x != nil {
+			opt.Trace = x
+			opt.Kafka = new(trace.Kafka)
+		}
+	}
+}
+
+// WithTraceContext 从 context 中获取trace信息, 效果同 WithTrace
+func WithTraceContext(ctx context.Context) OptionHandler {
+	return WithTrace(mux.TraceFromContext(ctx))
+}
+
+func newOption(options ...OptionHandler) *option {
+	opt := new(option)
+	for _, f := range options {
+		f(opt)
+	}
+	return opt
+}
+
+// injectTraceHeaders 把链路ID和调用点ID写入消息头, 返回调用点ID
+func injectTraceHeaders(m *sarama.ProducerMessage, t *trace.Trace) string {
+	if t == nil {
+		return ""
+	}
+	spanID := trace.NewSpanID()
+	m.Headers = append(m.Headers,
+		sarama.RecordHeader{Key: []byte(trace.Header), Value: []byte(t.ID())},
+		sarama.RecordHeader{Key: []byte(trace.SpanHeader), Value: []byte(spanID)},
+	)
+	return spanID
+}
+
+// appendProduceTrace 记录一条发送消息的 trace.Kafka
+func appendProduceTrace(t *trace.Trace, kafka *trace.Kafka, m *sarama.ProducerMessage, spanID string, ts time.Time, err error) {
+	if t == nil {
+		return
+	}
+	if kafka == nil {
+		kafka = new(trace.Kafka)
+	}
+	kafka.Timestamp = timex.CSTLayoutString()
+	kafka.Handle = "produce"
+	kafka.Topic = m.Topic
+	if m.Key != nil {
+		if key, e := m.Key.Encode(); e == nil {
+			kafka.Key = string(key)
+		}
+	}
+	kafka.Partition = m.Partition
+	kafka.Offset = m.Offset
+	kafka.SpanID = spanID
+	kafka.CostSeconds = time.Since(ts).Seconds()
+	if err != nil {
+		kafka.Message = err.Error()
+	}
+	t.AppendKafka(kafka)
+}
+
+// headerValue 获取消息头中的值
+func headerValue(headers []*sarama.RecordHeader, key string) string {
+	for _, h := range headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// newConsumeContext 从消息头中延续链路, 生成消费时使用的 context
+func newConsumeContext(m *sarama.ConsumerMessage) *mux.StdContext {
+	t := trace.Start("kafka:" + m.Topic)
+	if traceID := headerValue(m.Headers, trace.Header); traceID != "" {
+		t.TraceID = traceID
+	}
+	t.AppendKafka(&trace.Kafka{
+		Timestamp: timex.CSTLayoutString(),
+		Handle:    "consume",
+		Topic:     m.Topic,
+		Key:       string(m.Key),
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		SpanID:    headerValue(m.Headers, trace.SpanHeader),
+	})
+	ctx, cancel := context.WithCancel(trace.NewContext(context.Background(), t))
+	return &mux.StdContext{
+		Cancel:  cancel,
+		Context: ctx,
+		Trace:   t,
+		Logger:  loggerx.Default(),
+	}
+}
+
+// afterConsume 消息处理结束, 结束链路并通过 trace 的 Exporter 输出
+func afterConsume(ctx *mux.StdContext, err error, ts time.Time) {
+	if ctx.Cancel != nil {
+		ctx.Cancel()
+	}
+	t, ok := ctx.Trace.(*trace.Trace)
+	if !ok {
+		return
+	}
+	if len(t.Kafka) > 0 {
+		t.Kafka[0].CostSeconds = time.Since(ts).Seconds()
+		if err != nil {
+			t.Kafka[0].Message = err.Error()
+		}
+	}
+	t.Finish(err)
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"github.com/chenxinqun/ginWarpPkg/errno"
+	"github.com/chenxinqun/ginWarpPkg/httpx/mux"
 	"github.com/chenxinqun/ginWarpPkg/httpx/trace"
 	"os" //nolint:nolintlint,gci
 	"sync"
@@ -96,11 +97,17 @@ type ConsumeHandler func(msgChan <-chan *ConsumerMessage,
 
 type ConsumeGroupHandler func(msg *ConsumerMessage) (error, bool)
 
+// ConsumeGroupTraceHandler 带链路追踪的消费函数. ctx 中的 Trace 从消息头延续而来, 消费结束后会打印链路日志.
+// ctx 可以直接传给 mongox, mysqlx 等包使用, 消费期间的操作都会记录到这条链路中.
+type ConsumeGroupTraceHandler func(ctx *mux.StdContext, msg *ConsumerMessage) (error, bool)
+
 type ConsumerGroupRepo interface {
 	Close() error
 	GetClient() *ConsumerGroup
 	// Consume 消费者, 这个是一个阻塞的动作. 应该包裹在一个for循环中.
 	Consume(topics []Topic, handler ConsumeGroupHandler) error
+	// ConsumeWithTrace 同 Consume, 消费函数可以拿到从消息头延续的链路信息.
+	ConsumeWithTrace(topics []Topic, handler ConsumeGroupTraceHandler) error
 	Errors() <-chan error
 	GetConfig() Info
 }
@@ -126,6 +133,12 @@ type AsyncProducerRepo interface {
 	// SendMessages 批量发送消息, 返回消息指针数组. 关注 msg.PartitionConsumer, msg.Offset 两个变量.
 	SendMessages(topic Topic, key string, values ...interface{}) (msgList []*ProducerMessage, err error)
 	SendMessagesByte(topic Topic, key string, values ...[]byte) (msgList []*ProducerMessage, err error)
+	// SendMessageWithOptions 等同名方法, 可以传入 WithTrace 等选项.
+	// 传入 WithTrace 时, 会把链路ID写入消息头, 并记录 trace.Kafka
+	SendMessageWithOptions(topic Topic, key string, value interface{}, options ...OptionHandler) (msg *ProducerMessage, err error)
+	SendMessageByteWithOptions(topic Topic, key string, value []byte, options ...OptionHandler) (msg *ProducerMessage, err error)
+	SendMessagesWithOptions(topic Topic, key string, values []interface{}, options ...OptionHandler) (msgList []*ProducerMessage, err error)
+	SendMessagesByteWithOptions(topic Topic, key string, values [][]byte, options ...OptionHandler) (msgList []*ProducerMessage, err error)
 	// Successes is the success output channel back to the user when Return.Successes is
 	// enabled. If Return.Successes is true, you MUST read from this channel or the
 	// Producer will deadlock. It is suggested that you send and read messages
@@ -152,6 +165,12 @@ type ProducerRepo interface {
 	// SendMessages 批量发送消息, 返回消息指针数组. 关注 msg.PartitionConsumer, msg.Offset 两个变量.
 	SendMessages(topic Topic, key string, values ...interface{}) (msgList []*ProducerMessage, err error)
 	SendMessagesByte(topic Topic, key string, values ...[]byte) (msgList []*ProducerMessage, err error)
+	// SendMessageWithOptions 等同名方法, 可以传入 WithTrace 等选项.
+	// 传入 WithTrace 时, 会把链路ID写入消息头, 并记录 trace.Kafka
+	SendMessageWithOptions(topic Topic, key string, value interface{}, options ...OptionHandler) (msg *ProducerMessage, err error)
+	SendMessageByteWithOptions(topic Topic, key string, value []byte, options ...OptionHandler) (msg *ProducerMessage, err error)
+	SendMessagesWithOptions(topic Topic, key string, values []interface{}, options ...OptionHandler) (msgList []*ProducerMessage, err error)
+	SendMessagesByteWithOptions(topic Topic, key string, values [][]byte, options ...OptionHandler) (msgList []*ProducerMessage, err error)
 }
 
 type PartitionConsumerRepo interface {
@@ -124,6 +124,7 @@ func (d dummyCollection) Database() *mongo.Database {
 
 func (d dummyCollection) BulkWrite(ctx context.Context, models []mongo.WriteModel,
 	opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+	ctx = withTraceContext(ctx)
 	collection, err := d.obtainCollection(ctx)
 	if err != nil {
 		return nil, err
@@ -133,6 +134,7 @@ func (d dummyCollection) BulkWrite(ctx context.Context, models []mongo.WriteMode
 
 func (d dummyCollection) InsertOne(ctx context.Context, document interface{},
 	opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	ctx = withTraceContext(ctx)
 	collection, err := d.obtainCollection(ctx)
 	if err != nil {
 		return nil, err
@@ -142,6 +144,7 @@ func (d dummyCollection) InsertOne(ctx context.Context, document interface{},
 
 func (d dummyCollection) InsertMany(ctx context.Context, documents []interface{},
 	opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
+	ctx = withTraceContext(ctx)
 	collection, err := d.obtainCollection(ctx)
 	if err != nil {
 		return nil, err
@@ -151,6 +154,7 @@ func (d dummyCollection) InsertMany(ctx context.Context, documents []interface{}
 
 func (d dummyCollection) DeleteOne(ctx context.Context, filter interface{},
 	opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	ctx = withTraceContext(ctx)
 	collection, err := d.obtainCollection(ctx)
 	if err != nil {
 		return nil, err
@@ -160,6 +164,7 @@ func (d dummyCollection) DeleteOne(ctx context.Context, filter interface{},
 
 func (d dummyCollection) DeleteMany(ctx context.Context, filter interface{},
 	opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	ctx = withTraceContext(ctx)
 	collection, err := d.obtainCollection(ctx)
 	if err != nil {
 		return nil, err
@@ -169,6 +174,7 @@ func (d dummyCollection) DeleteMany(ctx context.Context, filter interface{},
 
 func (d dummyCollection) UpdateOne(ctx context.Context, filter interface{}, update interface{},
 	opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	ctx = withTraceContext(ctx)
 	collection, err := d.obtainCollection(ctx)
 	if err != nil {
 		return nil, err
@@ -178,6 +184,7 @@ func (d dummyCollection) UpdateOne(ctx context.Context, filter interface{}, upda
 
 func (d dummyCollection) UpdateMany(ctx context.Context, filter interface{}, update interface{},
 	opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	ctx = withTraceContext(ctx)
 	collection, err := d.obtainCollection(ctx)
 	if err != nil {
 		return nil, err
@@ -187,6 +194,7 @@ func (d dummyCollection) UpdateMany(ctx context.Context, filter interface{}, upd
 
 func (d dummyCollection) ReplaceOne(ctx context.Context, filter interface{}, replacement interface{},
 	opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error) {
+	ctx = withTraceContext(ctx)
 	collection, err := d.obtainCollection(ctx)
 	if err != nil {
 		return nil, err
@@ -196,6 +204,7 @@ func (d dummyCollection) ReplaceOne(ctx context.Context, filter interface{}, rep
 
 func (d dummyCollection) Aggregate(ctx context.Context, pipeline interface{},
 	opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+	ctx = withTraceContext(ctx)
 	collection, err := d.obtainCollection(ctx)
 	if err != nil {
 		return nil, err
@@ -205,6 +214,7 @@ func (d dummyCollection) Aggregate(ctx context.Context, pipeline interface{},
 
 func (d dummyCollection) CountDocuments(ctx context.Context, filter interface{},
 	opts ...*options.CountOptions) (int64, error) {
+	ctx = withTraceContext(ctx)
 	collection, err := d.obtainCollection(ctx)
 	if err != nil {
 		return 0, err
@@ -214,6 +224,7 @@ func (d dummyCollection) CountDocuments(ctx context.Context, filter interface{},
 
 func (d dummyCollection) EstimatedDocumentCount(ctx context.Context,
 	opts ...*options.EstimatedDocumentCountOptions) (int64, error) {
+	ctx = withTraceContext(ctx)
 	collection, err := d.obtainCollection(ctx)
 	if err != nil {
 		return 0, err
@@ -223,6 +234,7 @@ func (d dummyCollection) EstimatedDocumentCount(ctx context.Context,
 
 func (d dummyCollection) Distinct(ctx context.Context, fieldName string, filter interface{},
 	opts ...*options.DistinctOptions) ([]interface{}, error) {
+	ctx = withTraceContext(ctx)
 	collection, err := d.obtainCollection(ctx)
 	if err != nil {
 		return nil, err
@@ -232,6 +244,7 @@ func (d dummyCollection) Distinct(ctx context.Context, fieldName string, filter
 
 func (d dummyCollection) Find(ctx context.Context, filter interface{},
 	opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	ctx = withTraceContext(ctx)
 	collection, err := d.obtainCollection(ctx)
 	if err != nil {
 		return nil, err
@@ -344,6 +357,7 @@ func (p mongoPageData) Result(val interface{}) error {
 
 func (d dummyCollection) FindOne(ctx context.Context, filter interface{},
 	opts ...*options.FindOneOptions) *mongo.SingleResult {
+	ctx = withTraceContext(ctx)
 	collection, err := d.obtainCollection(ctx)
 	if err != nil {
 		panic(err)
@@ -353,6 +367,7 @@ func (d dummyCollection) FindOne(ctx context.Context, filter interface{},
 
 func (d dummyCollection) FindOneAndDelete(ctx context.Context, filter interface{},
 	opts ...*options.FindOneAndDeleteOptions) *mongo.SingleResult {
+	ctx = withTraceContext(ctx)
 	collection, err := d.obtainCollection(ctx)
 	if err != nil {
 		panic(err)
@@ -362,6 +377,7 @@ func (d dummyCollection) FindOneAndDelete(ctx context.Context, filter interface{
 
 func (d dummyCollection) FindOneAndReplace(ctx context.Context, filter interface{}, replacement interface{},
 	opts ...*options.FindOneAndReplaceOptions) *mongo.SingleResult {
+	ctx = withTraceContext(ctx)
 	collection, err := d.obtainCollection(ctx)
 	if err != nil {
 		panic(err)
@@ -371,6 +387,7 @@ func (d dummyCollection) FindOneAndReplace(ctx context.Context, filter interface
 
 func (d dummyCollection) FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{},
 	opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
+	ctx = withTraceContext(ctx)
 	collection, err := d.obtainCollection(ctx)
 	if err != nil {
 		panic(err)
@@ -380,6 +397,7 @@ func (d dummyCollection) FindOneAndUpdate(ctx context.Context, filter interface{
 
 func (d dummyCollection) Watch(ctx context.Context, pipeline interface{},
 	opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	ctx = withTraceContext(ctx)
 	collection, err := d.obtainCollection(ctx)
 	if err != nil {
 		return nil, err
@@ -396,6 +414,7 @@ func (d dummyCollection) Indexes() mongo.IndexView {
 }
 
 func (d dummyCollection) Drop(ctx context.Context) error {
+	ctx = withTraceContext(ctx)
 	collection, err := d.obtainCollection(ctx)
 	if err != nil {
 		return err
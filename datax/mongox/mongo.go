@@ -23,6 +23,8 @@ type Info struct {
 	Password string   `toml:"pwd" json:"pwd"`
 	MaxConn  int      `toml:"MaxConn" json:"MaxConn"`
 	TimeOut  int      `toml:"TimeOut" json:"TimeOut"` // 超时时间, 单位秒
+	// 慢查询阈值, 单位毫秒, 超过这个时间的命令会打印告警日志. 不填有默认值
+	SlowThreshold int `toml:"SlowThreshold" json:"SlowThreshold"`
 }
 
 type Option func(*option)
@@ -66,7 +68,7 @@ func New(cfg Info) (Repo, error) {
 	var repo Repo
 	// client, err := mongoConnect(cfg)
 	timeout := time.Second * time.Duration(cfg.TimeOut)
-	client, err := dialMongo(cfg.Addrs, cfg.Username, cfg.Password, timeout)
+	client, err := dialMongo(cfg.Addrs, cfg.Username, cfg.Password, timeout, cfg.SlowThreshold)
 	if err != nil {
 		return nil, err
 	}
@@ -110,7 +112,7 @@ func (c *Mongo) DefaultDatabase() DataBase {
 }
 
 // dialMongo will connection single server
-func dialMongo(addr []string, user, passwd string, timeout time.Duration) (*mongo.Client, error) {
+func dialMongo(addr []string, user, passwd string, timeout time.Duration, slowThreshold int) (*mongo.Client, error) {
 	defopts := options.Client()
 	defopts.SetHosts(addr)
 	if len(user) > 0 && len(passwd) > 0 {
@@ -136,6 +138,8 @@ func dialMongo(addr []string, user, passwd string, timeout time.Duration) (*mong
 	 * nearest:不管是主节点、secondary节点,从网络延迟最低的节点上读取数据.
 	 */
 	defopts.SetReadPreference(readpref.PrimaryPreferred())
+	// 注册命令监听, 用于链路追踪, 指标统计以及慢查询日志
+	defopts.SetMonitor(newCommandMonitor(slowThreshold))
 	opts := append(globalMongoOptions(), defopts)
 	cli, err := mongo.NewClient(opts...)
 	if err != nil {
@@ -188,7 +192,7 @@ func (c *Mongo) Close() {
 	_ = c.client.Disconnect(ctx)
 }
 
-// WithTrace 设置trace信息
+// WithTrace 设置trace信息, 配合 NewContext 使用
 func WithTrace(t Trace) Option {
 	return func(opt *option) {
 		if t != nil {
@@ -0,0 +1,206 @@
+package mongox
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/httpx/mux"
+	"github.com/chenxinqun/ginWarpPkg/httpx/trace"
+	"github.com/chenxinqun/ginWarpPkg/loggerx"
+	"github.com/chenxinqun/ginWarpPkg/metrics"
+	"github.com/chenxinqun/ginWarpPkg/timex"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultSlowThreshold 默认慢查询阈值, 单位毫秒
+	DefaultSlowThreshold = 500
+	// 查询条件摘要的最大长度
+	maxFilterLength = 512
+)
+
+// NewContext 把 trace 信息放入 context 中, 在 Collection 的方法中使用这个 context, 就会自动记录 trace.Mongo.
+// 等同于 trace.NewContext, 已经通过 trace.NewContext 或 mux.Context.RequestContext 得到的 context 无需再调用.
+//
+//	coll.Find(mongox.NewContext(ctx, mongox.WithTrace(c.Trace())), filter)
+func NewContext(ctx context.Context, options ...Option) context.Context {
+	opt := new(option)
+	for _, f := range options {
+		f(opt)
+	}
+	if opt.Trace == nil {
+		return ctx
+	}
+	return trace.NewContext(ctx, opt.Trace)
+}
+
+// withTraceContext 驱动内部会对 context 再做包装, 所以需要在进入驱动之前, 确保 trace 存放在 context 的 value 中
+func withTraceContext(ctx context.Context) context.Context {
+	if ctx == nil || trace.FromContext(ctx) != nil {
+		return ctx
+	}
+	if t := mux.TraceFromContext(ctx); t != nil {
+		return trace.NewContext(ctx, t)
+	}
+	return ctx
+}
+
+func traceFromContext(ctx context.Context) *trace.Trace {
+	t, _ := trace.FromContext(ctx).(*trace.Trace)
+	return t
+}
+
+// startedCommand 命令开始时记录的信息, 在命令结束时使用
+type startedCommand struct {
+	database   string
+	collection string
+	filter     string
+	ttl        time.Duration
+}
+
+type commandMonitor struct {
+	slowThreshold time.Duration
+	started       sync.Map
+}
+
+func newCommandMonitor(slowThreshold int) *event.CommandMonitor {
+	if slowThreshold <= 0 {
+		slowThreshold = DefaultSlowThreshold
+	}
+	m := &commandMonitor{slowThreshold: time.Duration(slowThreshold) * time.Millisecond}
+	return &event.CommandMonitor{
+		Started:   m.onStarted,
+		Succeeded: m.onSucceeded,
+		Failed:    m.onFailed,
+	}
+}
+
+func commandKey(connectionID string, requestID int64) string {
+	return fmt.Sprintf("%s-%d", connectionID, requestID)
+}
+
+func (m *commandMonitor) onStarted(ctx context.Context, evt *event.CommandStartedEvent) {
+	// 只记录作用于集合上的命令, hello, ping, 认证之类的命令不做记录
+	collection, ok := evt.Command.Lookup(evt.CommandName).StringValueOK()
+	if !ok {
+		return
+	}
+	cmd := &startedCommand{
+		database:   evt.DatabaseName,
+		collection: collection,
+		filter:     filterSummary(evt.CommandName, evt.Command),
+	}
+	if ctx != nil {
+		if deadline, ok := ctx.Deadline(); ok {
+			cmd.ttl = time.Until(deadline)
+		}
+	}
+	m.started.Store(commandKey(evt.ConnectionID, evt.RequestID), cmd)
+}
+
+func (m *commandMonitor) onSucceeded(ctx context.Context, evt *event.CommandSucceededEvent) {
+	m.finished(ctx, evt.CommandFinishedEvent, affectedCount(evt.CommandName, evt.Reply), "")
+}
+
+func (m *commandMonitor) onFailed(ctx context.Context, evt *event.CommandFailedEvent) {
+	m.finished(ctx, evt.CommandFinishedEvent, 0, evt.Failure)
+}
+
+func (m *commandMonitor) finished(ctx context.Context, evt event.CommandFinishedEvent, count int64, failure string) {
+	val, ok := m.started.LoadAndDelete(commandKey(evt.ConnectionID, evt.RequestID))
+	if !ok {
+		return
+	}
+	cmd := val.(*startedCommand)
+	cost := time.Duration(evt.DurationNanos)
+
+	metrics.RecordMongoMetrics(cmd.database, cmd.collection, evt.CommandName, failure == "", cost.Seconds())
+
+	if cost >= m.slowThreshold && loggerx.Default() != nil {
+		loggerx.Default().Warn("mongo慢查询",
+			zap.String("database", cmd.database),
+			zap.String("collection", cmd.collection),
+			zap.String("command", evt.CommandName),
+			zap.String("filter", cmd.filter),
+			zap.Int64("count_affected", count),
+			zap.Float64("cost_seconds", cost.Seconds()),
+			zap.String("failure", failure),
+		)
+	}
+
+	t := traceFromContext(ctx)
+	if t == nil {
+		return
+	}
+	mongoInfo := new(trace.Mongo)
+	mongoInfo.Timestamp = timex.CSTLayoutString()
+	mongoInfo.Handle = evt.CommandName
+	mongoInfo.Database = cmd.database
+	mongoInfo.Collection = cmd.collection
+	mongoInfo.Filter = cmd.filter
+	mongoInfo.Count = count
+	mongoInfo.TTL = cmd.ttl.Minutes()
+	mongoInfo.CostSeconds = cost.Seconds()
+	mongoInfo.Message = failure
+	t.AppendMongo(mongoInfo)
+}
+
+// filterSummary 从命令中提取查询条件的摘要
+func filterSummary(commandName string, command bson.Raw) string {
+	var val bson.RawValue
+	switch commandName {
+	case "find":
+		val = command.Lookup("filter")
+	case "count", "distinct", "findAndModify":
+		val = command.Lookup("query")
+	case "aggregate":
+		val = command.Lookup("pipeline")
+	case "update":
+		val = command.Lookup("updates", "0", "q")
+	case "delete":
+		val = command.Lookup("deletes", "0", "q")
+	default:
+		return ""
+	}
+	if val.Value == nil {
+		return ""
+	}
+	summary := val.String()
+	if len(summary) > maxFilterLength {
+		summary = summary[:maxFilterLength] + "..."
+	}
+	return summary
+}
+
+// affectedCount 从返回值中提取影响的文档数
+func affectedCount(commandName string, reply bson.Raw) int64 {
+	switch commandName {
+	case "find", "aggregate":
+		if batch, ok := reply.Lookup("cursor", "firstBatch").ArrayOK(); ok {
+			values, _ := batch.Values()
+			return int64(len(values))
+		}
+	case "distinct":
+		if values, ok := reply.Lookup("values").ArrayOK(); ok {
+			vals, _ := values.Values()
+			return int64(len(vals))
+		}
+	case "findAndModify":
+		if n, ok := reply.Lookup("lastErrorObject", "n").AsInt64OK(); ok {
+			return n
+		}
+	case "update":
+		if n, ok := reply.Lookup("nModified").AsInt64OK(); ok {
+			return n
+		}
+	}
+	if n, ok := reply.Lookup("n").AsInt64OK(); ok {
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,133 @@
+package mongox
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/httpx/trace"
+	"github.com/chenxinqun/ginWarpPkg/loggerx"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func mustRaw(t *testing.T, v interface{}) bson.Raw {
+	t.Helper()
+	b, err := bson.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestFilterSummary(t *testing.T) {
+	cases := []struct {
+		name    string
+		command bson.M
+		want    string
+	}{
+		{"find", bson.M{"find": "users", "filter": bson.M{"age": 18}}, `{"age": {"$numberInt":"18"}}`},
+		{"count", bson.M{"count": "users", "query": bson.M{"name": "a"}}, `{"name": "a"}`},
+		{"aggregate", bson.M{"aggregate": "users", "pipeline": bson.A{bson.M{"$match": bson.M{"name": "a"}}}}, `[{"$match": {"name": "a"}}]`},
+		{"update", bson.M{"update": "users", "updates": bson.A{bson.M{"q": bson.M{"name": "a"}}}}, `{"name": "a"}`},
+		{"delete", bson.M{"delete": "users", "deletes": bson.A{bson.M{"q": bson.M{"name": "b"}}}}, `{"name": "b"}`},
+		{"insert", bson.M{"insert": "users"}, ""},
+		{"find", bson.M{"find": "users"}, ""},
+	}
+	for _, c := range cases {
+		got := filterSummary(c.name, mustRaw(t, c.command))
+		if got != c.want {
+			t.Errorf("%s: got %s, want %s", c.name, got, c.want)
+		}
+	}
+
+	long := filterSummary("find", mustRaw(t, bson.M{"find": "users", "filter": bson.M{"name": strings.Repeat("a", 1024)}}))
+	if len(long) != maxFilterLength+3 || !strings.HasSuffix(long, "...") {
+		t.Errorf("long filter not truncated: %d", len(long))
+	}
+}
+
+func TestAffectedCount(t *testing.T) {
+	cases := []struct {
+		name  string
+		reply bson.M
+		want  int64
+	}{
+		{"find", bson.M{"cursor": bson.M{"firstBatch": bson.A{bson.M{}, bson.M{}}}}, 2},
+		{"aggregate", bson.M{"cursor": bson.M{"firstBatch": bson.A{}}}, 0},
+		{"distinct", bson.M{"values": bson.A{"a", "b", "c"}}, 3},
+		{"findAndModify", bson.M{"lastErrorObject": bson.M{"n": int32(1)}}, 1},
+		{"update", bson.M{"n": int32(3), "nModified": int32(2)}, 2},
+		{"delete", bson.M{"n": int64(4)}, 4},
+		{"insert", bson.M{"n": int32(5)}, 5},
+		{"count", bson.M{"n": int32(6)}, 6},
+		{"ping", bson.M{"ok": 1}, 0},
+	}
+	for _, c := range cases {
+		if got := affectedCount(c.name, mustRaw(t, c.reply)); got != c.want {
+			t.Errorf("%s: got %d, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestCommandMonitor(t *testing.T) {
+	buf := new(bytes.Buffer)
+	old := loggerx.Default()
+	loggerx.SetDefault(zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(buf), zap.DebugLevel)))
+	defer loggerx.SetDefault(old)
+
+	monitor := newCommandMonitor(100)
+	tr := trace.New("")
+	ctx := trace.NewContext(context.Background(), tr)
+
+	run := func(requestID int64, cost time.Duration) {
+		monitor.Started(ctx, &event.CommandStartedEvent{
+			Command:      mustRaw(t, bson.M{"find": "users", "filter": bson.M{"name": "a"}}),
+			DatabaseName: "test",
+			CommandName:  "find",
+			RequestID:    requestID,
+			ConnectionID: "conn-1",
+		})
+		monitor.Succeeded(ctx, &event.CommandSucceededEvent{
+			CommandFinishedEvent: event.CommandFinishedEvent{
+				DurationNanos: cost.Nanoseconds(),
+				CommandName:   "find",
+				RequestID:     requestID,
+				ConnectionID:  "conn-1",
+			},
+			Reply: mustRaw(t, bson.M{"cursor": bson.M{"firstBatch": bson.A{bson.M{}}}}),
+		})
+	}
+
+	run(1, 10*time.Millisecond)
+	if len(tr.Mongos) != 1 {
+		t.Fatalf("want 1 trace entry, got %d", len(tr.Mongos))
+	}
+	m := tr.Mongos[0]
+	if m.Handle != "find" || m.Database != "test" || m.Collection != "users" || m.Count != 1 || m.Filter != `{"name": "a"}` {
+		t.Errorf("unexpected trace entry: %+v", m)
+	}
+	if strings.Contains(buf.String(), "mongo慢查询") {
+		t.Errorf("fast command logged as slow: %s", buf.String())
+	}
+
+	run(2, 200*time.Millisecond)
+	if len(tr.Mongos) != 2 {
+		t.Fatalf("want 2 trace entries, got %d", len(tr.Mongos))
+	}
+	if !strings.Contains(buf.String(), "mongo慢查询") || !strings.Contains(buf.String(), `"collection":"users"`) {
+		t.Errorf("slow command not logged: %s", buf.String())
+	}
+
+	// 不作用于集合的命令不记录
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: mustRaw(t, bson.M{"ping": 1}), CommandName: "ping", RequestID: 3, ConnectionID: "conn-1"})
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "ping", RequestID: 3, ConnectionID: "conn-1"}})
+	if len(tr.Mongos) != 2 {
+		t.Errorf("ping recorded into trace")
+	}
+}
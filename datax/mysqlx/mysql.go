@@ -2,6 +2,7 @@ package mysqlx
 
 import (
 	"fmt"
+	"github.com/chenxinqun/ginWarpPkg/datax/gormx"
 	"github.com/chenxinqun/ginWarpPkg/errno"
 	"github.com/chenxinqun/ginWarpPkg/sysx/environment"
 	"math/rand"
@@ -33,6 +34,7 @@ type Info struct {
 		MaxOpenConn     int           `toml:"MaxOpenConn" json:"MaxOpenConn"`
 		MaxIDleConn     int           `toml:"MaxIDleConn" json:"MaxIDleConn"`
 		ConnMaxLifeTime time.Duration `toml:"ConnMaxLifeTime" json:"ConnMaxLifeTime"` // 最大连接超时时间单位分钟
+		SlowThreshold   int           `toml:"SlowThreshold" json:"SlowThreshold"`     // 慢查询阈值, 单位毫秒
 	} `toml:"Base"`
 }
 
@@ -81,7 +83,7 @@ func New(cfg Info) (Repo, error) {
 	}
 
 	// 注册链路追踪插件
-	_ = db.Use(new(TracePlugin))
+	_ = db.Use(gormx.NewPlugin(gormx.Config{Name: "mysql/" + write.Name, SlowThreshold: base.SlowThreshold}))
 
 	if environment.Active() != nil {
 		// 如果不是Pro和Pre环境, 开启db.Debug()模式
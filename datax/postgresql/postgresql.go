@@ -2,6 +2,7 @@ package postgresql
 
 import (
 	"fmt"
+	"github.com/chenxinqun/ginWarpPkg/datax/gormx"
 	"github.com/chenxinqun/ginWarpPkg/sysx/environment"
 	"github.com/pkg/errors"
 	"gorm.io/driver/postgres"
@@ -37,6 +38,7 @@ type Info struct {
 	MaxOpenConn     int           `toml:"MaxOpenConn" json:"MaxOpenConn"`         // 最大连接数
 	MaxIDleConn     int           `toml:"MaxIDleConn" json:"MaxIDleConn"`         // 最大空闲连接数
 	ConnMaxLifeTime time.Duration `toml:"ConnMaxLifeTime" json:"ConnMaxLifeTime"` // 最大连接超时时间, 单位分钟
+	SlowThreshold   int           `toml:"SlowThreshold" json:"SlowThreshold"`     // 慢查询阈值, 单位毫秒
 }
 
 var _ Repo = (*DB)(nil)
@@ -62,6 +64,9 @@ func New(cfg Info) (Repo, error) {
 	if err != nil {
 		return nil, err
 	}
+	// 注册链路追踪插件
+	_ = db.Use(gormx.NewPlugin(gormx.Config{Name: "postgres/" + cfg.Name, SlowThreshold: cfg.SlowThreshold}))
+
 	if environment.Active() != nil {
 		// 如果不是Pro和Pre环境, 开启db.Debug()模式
 		if !environment.Active().IsPro() && !environment.Active().IsPre() {
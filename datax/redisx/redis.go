@@ -3,6 +3,7 @@ package redisx
 import (
 	"context"
 	"github.com/chenxinqun/ginWarpPkg/errno"
+	"github.com/chenxinqun/ginWarpPkg/httpx/mux"
 	"github.com/chenxinqun/ginWarpPkg/httpx/trace"
 	"strings"
 	"time"
@@ -410,6 +411,11 @@ func WithTrace(t Trace) OptionHandler {
 	}
 }
 
+// WithTraceContext 从 context 中获取trace信息, 效果同 WithTrace
+func WithTraceContext(ctx context.Context) OptionHandler {
+	return WithTrace(mux.TraceFromContext(ctx))
+}
+
 func (c *DB) Keys(pattern string) *redis.StringSliceCmd {
 	ctx, cancel := TimeOutCtx(c.Cfg.TimeOut)
 	defer cancel()
@@ -46,6 +46,10 @@ func New429Errno(businessCode int, err error) *Errno {
 	return NewBaseErrno(http.StatusTooManyRequests, businessCode, err)
 }
 
+func New503Errno(businessCode int, err error) *Errno {
+	return NewBaseErrno(http.StatusServiceUnavailable, businessCode, err)
+}
+
 // WrapParamBindError 请求参数绑定到go对象错误.
 // 请求参数序列化错误.
 func WrapParamBindErrno(err error) *Errno {
@@ -17,6 +17,11 @@ func (e errorx) Error() string {
 	return e.err.Error()
 }
 
+// Unwrap 支持 errors.Is 和 errors.As 判断包装的错误
+func (e errorx) Unwrap() error {
+	return e.err
+}
+
 // New returns an error with the supplied message.
 // New also records the stack trace at the point it was called.
 func NewError(message string) Error {
@@ -0,0 +1,316 @@
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/businessCodex"
+	"github.com/chenxinqun/ginWarpPkg/errno"
+	"github.com/chenxinqun/ginWarpPkg/loggerx"
+	"github.com/chenxinqun/ginWarpPkg/metrics"
+
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultWindowSize           = 20
+	DefaultMinRequests          = 10
+	DefaultFailureRateThreshold = 0.5
+	DefaultSlowCallThreshold    = 5 * time.Second
+	DefaultSlowCallRate         = 1.0
+	DefaultOpenTimeout          = 30 * time.Second
+	DefaultHalfOpenMaxCalls     = 5
+)
+
+// State 熔断器状态
+type State int
+
+const (
+	// StateClosed 关闭, 请求正常通过
+	StateClosed State = iota
+	// StateOpen 打开, 请求直接失败
+	StateOpen
+	// StateHalfOpen 半开, 放行少量探测请求, 全部成功后关闭, 有一个失败重新打开
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Fallback 熔断时的降级处理, 返回值作为响应内容返回给调用方
+type Fallback func(key string, err error) (body []byte, e error)
+
+// Config 熔断器配置, 数值类的字段不填时使用默认值
+type Config struct {
+	// Name 熔断器名称, 用于日志和指标区分
+	Name string `toml:"name" json:"name"`
+	// WindowSize 统计最近多少次请求的结果
+	WindowSize int `toml:"windowSize" json:"windowSize"`
+	// MinRequests 统计窗口内请求数达到这个值才会计算失败率
+	MinRequests int `toml:"minRequests" json:"minRequests"`
+	// FailureRateThreshold 失败率达到这个值时打开熔断器, 取值 0 ~ 1
+	FailureRateThreshold float64 `toml:"failureRateThreshold" json:"failureRateThreshold"`
+	// SlowCallThreshold 耗时超过这个值的请求为慢请求
+	SlowCallThreshold time.Duration `toml:"slowCallThreshold" json:"slowCallThreshold"`
+	// SlowCallRateThreshold 慢请求比例达到这个值时打开熔断器, 取值 0 ~ 1, 默认 1 即所有请求都是慢请求时才打开
+	SlowCallRateThreshold float64 `toml:"slowCallRateThreshold" json:"slowCallRateThreshold"`
+	// OpenTimeout 熔断器打开多久之后进入半开状态
+	OpenTimeout time.Duration `toml:"openTimeout" json:"openTimeout"`
+	// HalfOpenMaxCalls 半开状态下放行的探测请求数
+	HalfOpenMaxCalls int `toml:"halfOpenMaxCalls" json:"halfOpenMaxCalls"`
+	// Fallback 熔断时的降级处理, 不填则直接返回错误
+	Fallback Fallback `toml:"-" json:"-"`
+}
+
+func (c *Config) setDefaults() {
+	if c.Name == "" {
+		c.Name = "default"
+	}
+	if c.WindowSize <= 0 {
+		c.WindowSize = DefaultWindowSize
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = DefaultMinRequests
+	}
+	if c.MinRequests > c.WindowSize {
+		c.MinRequests = c.WindowSize
+	}
+	if c.FailureRateThreshold <= 0 || c.FailureRateThreshold > 1 {
+		c.FailureRateThreshold = DefaultFailureRateThreshold
+	}
+	if c.SlowCallThreshold <= 0 {
+		c.SlowCallThreshold = DefaultSlowCallThreshold
+	}
+	if c.SlowCallRateThreshold <= 0 || c.SlowCallRateThreshold > 1 {
+		c.SlowCallRateThreshold = DefaultSlowCallRate
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = DefaultOpenTimeout
+	}
+	if c.HalfOpenMaxCalls <= 0 {
+		c.HalfOpenMaxCalls = DefaultHalfOpenMaxCalls
+	}
+}
+
+// OpenError 熔断器打开时拒绝请求的错误, 由 NewOpenErrno 包装在 *errno.Errno 中返回
+type OpenError struct {
+	Name string
+	Key  string
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit breaker `%s` is open for `%s`", e.Name, e.Key)
+}
+
+// NewOpenErrno 熔断器打开时返回的错误, HTTP 状态码 503, 业务码为 businessCodex.GetServiceUnavailableCode()
+func NewOpenErrno(name, key string) *errno.Errno {
+	return errno.New503Errno(businessCodex.GetServiceUnavailableCode(), &OpenError{Name: name, Key: key})
+}
+
+// IsOpenErr 判断是否为熔断器打开返回的错误, 远端返回的 503 业务错误不算
+func IsOpenErr(err error) bool {
+	var oe *OpenError
+	if errors.As(err, &oe) {
+		return true
+	}
+	var e *errno.Errno
+	return errors.As(err, &e) && e.GetErr() != nil && errors.As(e.GetErr(), &oe)
+}
+
+// Group 按 key (域名或者服务实例) 管理熔断器
+type Group struct {
+	cfg      Config
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+func NewGroup(cfg Config) *Group {
+	cfg.setDefaults()
+	return &Group{cfg: cfg, breakers: make(map[string]*Breaker)}
+}
+
+// Get 获取 key 对应的熔断器, 不存在则创建
+func (g *Group) Get(key string) *Breaker {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	b, ok := g.breakers[key]
+	if !ok {
+		b = newBreaker(g.cfg, key)
+		g.breakers[key] = b
+	}
+	return b
+}
+
+// Remove 删除 key 对应的熔断器和指标, 用于服务实例下线后释放状态
+func (g *Group) Remove(key string) {
+	g.mu.Lock()
+	_, ok := g.breakers[key]
+	delete(g.breakers, key)
+	g.mu.Unlock()
+	if ok {
+		metrics.DeleteBreaker(g.cfg.Name, key)
+	}
+}
+
+// Config 获取熔断器配置
+func (g *Group) Config() Config {
+	return g.cfg
+}
+
+// States 获取所有熔断器的状态
+func (g *Group) States() map[string]State {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ret := make(map[string]State, len(g.breakers))
+	for key, b := range g.breakers {
+		ret[key] = b.State()
+	}
+	return ret
+}
+
+// Breaker 单个 key 的熔断器, 使用最近 WindowSize 次请求的结果计算失败率和慢请求比例
+type Breaker struct {
+	cfg Config
+	key string
+
+	mu       sync.Mutex
+	state    State
+	openedAt time.Time
+	// 环形窗口, 记录最近请求是否失败, 是否慢请求
+	failures []bool
+	slows    []bool
+	pos      int
+	count    int
+	// 半开状态下已放行和已成功的探测请求数
+	probes    int
+	successes int
+}
+
+func newBreaker(cfg Config, key string) *Breaker {
+	return &Breaker{
+		cfg:      cfg,
+		key:      key,
+		failures: make([]bool, cfg.WindowSize),
+		slows:    make([]bool, cfg.WindowSize),
+	}
+}
+
+// State 当前状态
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.cfg.OpenTimeout {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// Allow 判断请求是否可以通过, 通过后需要调用 Done 记录请求结果; 不通过时返回 NewOpenErrno 的错误.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.cfg.OpenTimeout {
+			metrics.RecordBreakerRejected(b.cfg.Name, b.key)
+			return NewOpenErrno(b.cfg.Name, b.key)
+		}
+		b.transition(StateHalfOpen)
+		fallthrough
+	case StateHalfOpen:
+		if b.probes >= b.cfg.HalfOpenMaxCalls {
+			metrics.RecordBreakerRejected(b.cfg.Name, b.key)
+			return NewOpenErrno(b.cfg.Name, b.key)
+		}
+		b.probes++
+	}
+	return nil
+}
+
+// Done 记录请求结果
+func (b *Breaker) Done(success bool, cost time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	slow := cost >= b.cfg.SlowCallThreshold
+	switch b.state {
+	case StateHalfOpen:
+		if !success || slow {
+			b.transition(StateOpen)
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenMaxCalls {
+			b.transition(StateClosed)
+		}
+	case StateClosed:
+		b.failures[b.pos] = !success
+		b.slows[b.pos] = slow
+		b.pos = (b.pos + 1) % b.cfg.WindowSize
+		if b.count < b.cfg.WindowSize {
+			b.count++
+		}
+		if b.count < b.cfg.MinRequests {
+			return
+		}
+		var failures, slows int
+		for i := 0; i < b.count; i++ {
+			if b.failures[i] {
+				failures++
+			}
+			if b.slows[i] {
+				slows++
+			}
+		}
+		if float64(failures)/float64(b.count) >= b.cfg.FailureRateThreshold ||
+			float64(slows)/float64(b.count) >= b.cfg.SlowCallRateThreshold {
+			b.transition(StateOpen)
+		}
+	}
+}
+
+// Fallback 熔断时调用降级处理, 没有配置降级处理则返回原错误
+func (b *Breaker) Fallback(err error) ([]byte, error) {
+	if b.cfg.Fallback == nil {
+		return nil, err
+	}
+	return b.cfg.Fallback(b.key, err)
+}
+
+// transition 状态变更, 调用方需要持有锁
+func (b *Breaker) transition(to State) {
+	from := b.state
+	if from == to {
+		return
+	}
+	b.state = to
+	b.probes, b.successes = 0, 0
+	switch to {
+	case StateOpen:
+		b.openedAt = time.Now()
+	case StateClosed:
+		b.pos, b.count = 0, 0
+	}
+
+	metrics.RecordBreakerTransition(b.cfg.Name, b.key, from.String(), to.String(), int(to))
+	if logger := loggerx.Default(); logger != nil {
+		logger.Warn("熔断器状态变更",
+			zap.String("name", b.cfg.Name),
+			zap.String("key", b.key),
+			zap.String("from", from.String()),
+			zap.String("to", to.String()),
+		)
+	}
+}
@@ -0,0 +1,73 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/businessCodex"
+	"github.com/chenxinqun/ginWarpPkg/errno"
+)
+
+func TestBreaker(t *testing.T) {
+	g := NewGroup(Config{
+		Name:             "test",
+		WindowSize:       4,
+		MinRequests:      4,
+		OpenTimeout:      20 * time.Millisecond,
+		HalfOpenMaxCalls: 2,
+		Fallback: func(key string, err error) ([]byte, error) {
+			return []byte("fallback"), nil
+		},
+	})
+	b := g.Get("127.0.0.1:80")
+
+	for i := 0; i < 4; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("closed breaker should allow, got %v", err)
+		}
+		b.Done(i%2 == 0, time.Millisecond)
+	}
+	if b.State() != StateOpen {
+		t.Fatalf("state = %s, want open", b.State())
+	}
+	err := b.Allow()
+	if !IsOpenErr(err) {
+		t.Fatalf("open breaker should reject, got %v", err)
+	}
+	if body, e := b.Fallback(err); e != nil || string(body) != "fallback" {
+		t.Fatalf("Fallback() = %s, %v", body, e)
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if err = b.Allow(); err != nil {
+			t.Fatalf("half-open breaker should allow probe, got %v", err)
+		}
+	}
+	if err = b.Allow(); err == nil {
+		t.Fatal("half-open breaker should limit probes")
+	}
+	b.Done(true, time.Millisecond)
+	b.Done(true, time.Millisecond)
+	if b.State() != StateClosed {
+		t.Fatalf("state = %s, want closed", b.State())
+	}
+
+	if IsOpenErr(errors.New("other")) {
+		t.Error("IsOpenErr() should be false for other errors")
+	}
+	// 远端返回的 503 业务错误不是熔断错误
+	remote := errno.New503Errno(businessCodex.GetServiceUnavailableCode(), errors.New("remote unavailable"))
+	if IsOpenErr(remote) {
+		t.Error("IsOpenErr() should be false for remote 503 errno")
+	}
+	if !IsOpenErr(errno.Wrapf(NewOpenErrno("test", "key"), "call")) {
+		t.Error("IsOpenErr() should be true for wrapped open error")
+	}
+
+	g.Remove("127.0.0.1:80")
+	if _, ok := g.States()["127.0.0.1:80"]; ok {
+		t.Error("Remove() should delete breaker")
+	}
+}
@@ -0,0 +1,96 @@
+package cassette
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Request 录制的请求
+type Request struct {
+	Method string      `json:"method" yaml:"method"`
+	URL    string      `json:"url" yaml:"url"`
+	Header http.Header `json:"header,omitempty" yaml:"header,omitempty"`
+	Body   string      `json:"body,omitempty" yaml:"body,omitempty"`
+}
+
+// Response 录制的响应
+type Response struct {
+	StatusCode int         `json:"status_code" yaml:"status_code"`
+	Header     http.Header `json:"header,omitempty" yaml:"header,omitempty"`
+	Body       string      `json:"body,omitempty" yaml:"body,omitempty"`
+}
+
+// Interaction 一次请求和响应
+type Interaction struct {
+	Request  Request  `json:"request" yaml:"request"`
+	Response Response `json:"response" yaml:"response"`
+
+	replayed bool
+}
+
+// Cassette 录制文件, 根据文件后缀使用 YAML(.yaml, .yml) 或 JSON(.json) 格式
+type Cassette struct {
+	Path         string         `json:"-" yaml:"-"`
+	Interactions []*Interaction `json:"interactions" yaml:"interactions"`
+
+	mu sync.Mutex
+}
+
+func isJSON(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// Load 读取录制文件
+func Load(path string) (*Cassette, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read cassette `%s` err", path)
+	}
+	c := &Cassette{Path: path}
+	if isJSON(path) {
+		err = json.Unmarshal(raw, c)
+	} else {
+		err = yaml.Unmarshal(raw, c)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "unmarshal cassette `%s` err", path)
+	}
+	return c, nil
+}
+
+// Save 保存录制文件, 目录不存在时自动创建
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var (
+		raw []byte
+		err error
+	)
+	if isJSON(c.Path) {
+		raw, err = json.MarshalIndent(c, "", "  ")
+	} else {
+		raw, err = yaml.Marshal(c)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "marshal cassette `%s` err", c.Path)
+	}
+	if err = os.MkdirAll(filepath.Dir(c.Path), os.ModePerm); err != nil {
+		return errors.Wrapf(err, "create cassette dir `%s` err", c.Path)
+	}
+	return errors.Wrapf(ioutil.WriteFile(c.Path, raw, 0644), "write cassette `%s` err", c.Path)
+}
+
+func (c *Cassette) add(i *Interaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Interactions = append(c.Interactions, i)
+}
@@ -0,0 +1,64 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// Matcher 判断请求是否和录制的请求匹配, 不匹配时返回差异说明
+type Matcher func(r *http.Request, body []byte, recorded Request) (diff string)
+
+// MatchMethod 匹配请求方式
+func MatchMethod(r *http.Request, _ []byte, recorded Request) string {
+	if r.Method != recorded.Method {
+		return fmt.Sprintf("method: got %s, recorded %s", r.Method, recorded.Method)
+	}
+	return ""
+}
+
+// MatchURL 匹配完整的请求地址, query 参数的顺序不影响匹配
+func MatchURL(r *http.Request, _ []byte, recorded Request) string {
+	got := r.URL.String()
+	if got == recorded.URL {
+		return ""
+	}
+	u := *r.URL
+	u.RawQuery = r.URL.Query().Encode()
+	if rec, err := r.URL.Parse(recorded.URL); err == nil {
+		rec.RawQuery = rec.Query().Encode()
+		if u.String() == rec.String() {
+			return ""
+		}
+	}
+	return fmt.Sprintf("url: got %s, recorded %s", got, recorded.URL)
+}
+
+// MatchBody 匹配请求体, 都是 JSON 时按 JSON 的内容比较, 忽略字段顺序和空白
+func MatchBody(_ *http.Request, body []byte, recorded Request) string {
+	if bytes.Equal(body, []byte(recorded.Body)) {
+		return ""
+	}
+	var got, rec interface{}
+	if json.Unmarshal(body, &got) == nil && json.Unmarshal([]byte(recorded.Body), &rec) == nil && reflect.DeepEqual(got, rec) {
+		return ""
+	}
+	return fmt.Sprintf("body:\n\tgot      %s\n\trecorded %s", body, recorded.Body)
+}
+
+// MatchHeaders 匹配指定的请求头
+func MatchHeaders(keys ...string) Matcher {
+	return func(r *http.Request, _ []byte, recorded Request) string {
+		for _, key := range keys {
+			if got, rec := r.Header.Get(key), recorded.Header.Get(key); got != rec {
+				return fmt.Sprintf("header %s: got %q, recorded %q", key, got, rec)
+			}
+		}
+		return ""
+	}
+}
+
+// DefaultMatchers 默认匹配请求方式, 请求地址和请求体
+var DefaultMatchers = []Matcher{MatchMethod, MatchURL, MatchBody}
@@ -0,0 +1,268 @@
+package cassette
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// Mode 录制或回放模式
+type Mode int
+
+const (
+	// ModeReplay 回放, 只使用录制文件中的响应, 不发起真实请求
+	ModeReplay Mode = iota
+	// ModeRecord 录制, 发起真实请求并保存到录制文件
+	ModeRecord
+	// ModeAuto 录制文件存在时回放, 不存在时录制
+	ModeAuto
+)
+
+// DefaultFilterHeaders 录制时默认不保存的请求头
+var DefaultFilterHeaders = []string{"Authorization"}
+
+// OptionHandler 自定义设置录制回放
+type OptionHandler func(*option)
+
+type option struct {
+	mode          Mode
+	matchers      []Matcher
+	transport     http.RoundTripper
+	filterHeaders []string
+}
+
+// WithMode 设置模式, 默认为 ModeAuto
+func WithMode(mode Mode) OptionHandler {
+	return func(opt *option) {
+		opt.mode = mode
+	}
+}
+
+// WithMatchers 设置回放时的请求匹配规则, 默认为 DefaultMatchers
+func WithMatchers(matchers ...Matcher) OptionHandler {
+	return func(opt *option) {
+		opt.matchers = matchers
+	}
+}
+
+// WithTransport 录制时发起真实请求使用的 RoundTripper, 默认为 http.DefaultTransport
+func WithTransport(rt http.RoundTripper) OptionHandler {
+	return func(opt *option) {
+		opt.transport = rt
+	}
+}
+
+// WithFilterHeaders 录制时不保存的请求头, 如 token, 签名等敏感信息
+func WithFilterHeaders(keys ...string) OptionHandler {
+	return func(opt *option) {
+		opt.filterHeaders = keys
+	}
+}
+
+// Recorder 录制回放的 http.RoundTripper.
+//
+//	rec, _ := cassette.New(t, "testdata/user.yaml")
+//	httpClient.RegisterProfileClient(httpClient.DefaultProfile, rec.Client())
+type Recorder struct {
+	t        testing.TB
+	cassette *Cassette
+	opt      *option
+}
+
+// New 创建录制回放, t 不为 nil 时, 回放找不到匹配的请求会让测试失败, 并在测试结束时自动保存录制文件.
+func New(t testing.TB, path string, options ...OptionHandler) (*Recorder, error) {
+	opt := &option{
+		mode:          ModeAuto,
+		matchers:      DefaultMatchers,
+		transport:     http.DefaultTransport,
+		filterHeaders: DefaultFilterHeaders,
+	}
+	for _, f := range options {
+		f(opt)
+	}
+	if opt.mode == ModeAuto {
+		opt.mode = ModeRecord
+		if _, err := os.Stat(path); err == nil {
+			opt.mode = ModeReplay
+		}
+	}
+
+	r := &Recorder{t: t, opt: opt}
+	if opt.mode == ModeReplay {
+		c, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		r.cassette = c
+	} else {
+		r.cassette = &Cassette{Path: path}
+	}
+
+	if t != nil {
+		t.Cleanup(func() {
+			if err := r.Stop(); err != nil {
+				t.Errorf("save cassette err: %v", err)
+			}
+		})
+	}
+	return r, nil
+}
+
+// Mode 当前的模式
+func (r *Recorder) Mode() Mode {
+	return r.opt.mode
+}
+
+// Stop 录制模式下保存录制文件
+func (r *Recorder) Stop() error {
+	if r.opt.mode != ModeRecord {
+		return nil
+	}
+	return r.cassette.Save()
+}
+
+// Client 返回使用录制回放的 http.Client
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Interceptor 作为 httpClient.WithInterceptor 的拦截器使用, 录制时使用下一级的 RoundTripper 发起真实请求
+func (r *Recorder) Interceptor() func(next http.RoundTripper) http.RoundTripper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return r.roundTrip(req, next)
+		})
+	}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	return r.roundTrip(req, r.opt.transport)
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func (r *Recorder) roundTrip(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, errors.Wrap(err, "read request body err")
+		}
+		_ = req.Body.Close()
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	if r.opt.mode == ModeRecord {
+		return r.record(req, body, next)
+	}
+	return r.replay(req, body)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte, next http.RoundTripper) (*http.Response, error) {
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "read response body err")
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	header := req.Header.Clone()
+	for _, key := range r.opt.filterHeaders {
+		header.Del(key)
+	}
+	r.cassette.add(&Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: header,
+			Body:   string(body),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header.Clone(),
+			Body:       string(respBody),
+		},
+	})
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	r.cassette.mu.Lock()
+	defer r.cassette.mu.Unlock()
+
+	var (
+		matched     *Interaction
+		closest     = -1
+		closestDiff []string
+	)
+	for i, interaction := range r.cassette.Interactions {
+		diffs := r.diff(req, body, interaction.Request)
+		if len(diffs) == 0 {
+			// 优先使用还没有回放过的
+			if !interaction.replayed {
+				matched = interaction
+				break
+			}
+			if matched == nil {
+				matched = interaction
+			}
+			continue
+		}
+		if closest < 0 || len(diffs) < len(closestDiff) {
+			closest, closestDiff = i, diffs
+		}
+	}
+
+	if matched == nil {
+		msg := fmt.Sprintf("cassette `%s`: no recorded interaction matches [%s %s]", r.cassette.Path, req.Method, req.URL.String())
+		if closest >= 0 {
+			msg += fmt.Sprintf("\nclosest recorded interaction #%d:\n\t%s", closest, strings.Join(closestDiff, "\n\t"))
+		}
+		if r.t != nil {
+			r.t.Error(msg)
+		}
+		return nil, errors.New(msg)
+	}
+
+	matched.replayed = true
+	header := matched.Response.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", matched.Response.StatusCode, http.StatusText(matched.Response.StatusCode)),
+		StatusCode:    matched.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(matched.Response.Body)),
+		ContentLength: int64(len(matched.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+func (r *Recorder) diff(req *http.Request, body []byte, recorded Request) []string {
+	diffs := make([]string, 0)
+	for _, m := range r.opt.matchers {
+		if d := m(req, body, recorded); d != "" {
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,52 @@
+package cassette
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("echo:" + string(raw)))
+	}))
+	path := filepath.Join(t.TempDir(), "echo.yaml")
+
+	rec, err := New(nil, path)
+	if err != nil || rec.Mode() != ModeRecord {
+		t.Fatalf("New() mode = %v, err = %v", rec.Mode(), err)
+	}
+	resp, err := rec.Client().Post(srv.URL+"/echo?b=2&a=1", "application/json", strings.NewReader(`{"a": 1, "b": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if err = rec.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	rec, err = New(nil, path)
+	if err != nil || rec.Mode() != ModeReplay {
+		t.Fatalf("New() mode = %v, err = %v", rec.Mode(), err)
+	}
+	resp, err = rec.Client().Post(srv.URL+"/echo?a=1&b=2", "application/json", strings.NewReader(`{"b":2,"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || string(raw) != `echo:{"a": 1, "b": 2}` {
+		t.Fatalf("replay got %d %s", resp.StatusCode, raw)
+	}
+
+	_, err = rec.Client().Post(srv.URL+"/echo?a=1&b=2", "application/json", strings.NewReader(`{"a":3}`))
+	if err == nil || !strings.Contains(err.Error(), "body:") {
+		t.Fatalf("unmatched request should return diff, got %v", err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 // AlarmVerify Verify parse the body and verify that it is correct.
 type AlarmVerify func(body []byte) (shouldAlarm bool)
 
+// AlarmObject 告警发送, alarm 包提供了邮件, webhook 和钉钉/企业微信/飞书机器人的实现, 以及去重限流的 alarm.Throttle
 type AlarmObject interface {
 	Send(subject, body string) error
 }
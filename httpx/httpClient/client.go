@@ -36,6 +36,15 @@ func PostJSON(url string, requestData interface{}, options ...OptionHandler) (bo
 	return withJSONBody(http.MethodPost, url, raw, options...)
 }
 
+// PostForm post application/x-www-form-urlencoded 请求, requestData 支持 url.Values, map[string]string 和结构体.
+func PostForm(url string, requestData interface{}, options ...OptionHandler) (body []byte, httpCode int, err error) {
+	form, err := toQuery(requestData)
+	if err != nil {
+		return nil, 0, err
+	}
+	return withFormBody(http.MethodPost, url, form, options...)
+}
+
 // PutJSON put json 请求.
 func PutJSON(url string, requestData interface{}, options ...OptionHandler) (body []byte, httpCode int, err error) {
 	raw := requestData.(json.RawMessage)
@@ -85,7 +94,7 @@ func withOutJsonBody(method, url string, form httpURL.Values, options ...OptionH
 		ttl = DefaultTTL
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), ttl)
+	ctx, cancel := context.WithTimeout(opt.parentContext(), ttl)
 	defer cancel()
 
 	if opt.dialog != nil {
@@ -136,7 +145,7 @@ func withFormBody(method, url string, form httpURL.Values, options ...OptionHand
 		ttl = DefaultTTL
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), ttl)
+	ctx, cancel := context.WithTimeout(opt.parentContext(), ttl)
 	defer cancel()
 
 	formValue := form.Encode()
@@ -188,7 +197,7 @@ func withJSONBody(method, url string, raw json.RawMessage, options ...OptionHand
 		ttl = DefaultTTL
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), ttl)
+	ctx, cancel := context.WithTimeout(opt.parentContext(), ttl)
 	defer cancel()
 
 	if opt.dialog != nil {
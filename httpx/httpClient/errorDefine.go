@@ -1,5 +1,7 @@
 package httpClient
 
+import "net/http"
+
 var _ ReplyErr = (*replyError)(nil)
 
 // ReplyErr 错误响应，当 resp.StatusCode != http.StatusOK 时用来包装返回的 httpcode 和 body 。
@@ -13,6 +15,7 @@ type replyError struct {
 	err        error
 	statusCode int
 	body       []byte
+	header     http.Header
 }
 
 func (r *replyError) Error() string {
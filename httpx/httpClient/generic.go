@@ -0,0 +1,158 @@
+package httpClient
+
+import (
+	"encoding/json"
+	"net/http"
+	httpURL "net/url"
+
+	"github.com/chenxinqun/ginWarpPkg/businessCodex"
+	"github.com/chenxinqun/ginWarpPkg/convert"
+	"github.com/chenxinqun/ginWarpPkg/errno"
+)
+
+// Envelope businessCodex.Response 的解析结构, Data 延迟解析到调用方的类型中
+type Envelope struct {
+	Code int             `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// WithUnwrap 返回值是 businessCodex.Response 格式时使用, 只把 data 解析到返回值中.
+// 业务码不是成功码时, 返回携带 HTTP 状态码, 业务码和描述信息的 *errno.Errno.
+func WithUnwrap() OptionHandler {
+	return func(opt *option) {
+		opt.unwrap = true
+	}
+}
+
+// Get 发起 get 请求, query 支持 url.Values, map[string]string 和结构体(通过 convert.StructToQuery 转换), 返回值解析到 T 中.
+func Get[T any](url string, query interface{}, options ...OptionHandler) (T, error) {
+	return Do[T](http.MethodGet, url, query, options...)
+}
+
+// Post 发起 post json 请求, body 支持 json.RawMessage, []byte 和可以 json 序列化的对象, 返回值解析到 T 中.
+func Post[T any](url string, body interface{}, options ...OptionHandler) (T, error) {
+	return Do[T](http.MethodPost, url, body, options...)
+}
+
+// Do 发起请求, GET, DELETE, HEAD 的请求参数拼接到 url 中, 其他请求方式的请求参数作为 json body 发送.
+// T 为 []byte 或 string 时直接返回响应内容, 否则按 json 解析.
+func Do[T any](method, url string, data interface{}, options ...OptionHandler) (ret T, err error) {
+	// 请求参数编码时还拿不到 option, 在请求中解析 option 时顺便记录是否需要解析信封, 避免 option 执行两次
+	var unwrap bool
+	options = append(options[:len(options):len(options)], func(opt *option) {
+		unwrap = opt.unwrap
+	})
+
+	var body []byte
+	switch method {
+	case http.MethodGet, http.MethodDelete, http.MethodHead:
+		var form httpURL.Values
+		if form, err = toQuery(data); err != nil {
+			return
+		}
+		body, _, err = withOutJsonBody(method, url, form, options...)
+	default:
+		var raw json.RawMessage
+		if raw, err = toJSON(data); err != nil {
+			return
+		}
+		if len(raw) == 0 {
+			body, _, err = withOutJsonBody(method, url, nil, options...)
+		} else {
+			body, _, err = withJSONBody(method, url, raw, options...)
+		}
+	}
+
+	if err != nil {
+		if e, ok := ToReplyErr(err); ok && unwrap {
+			if bizErr := ToBusinessErrno(e.StatusCode(), e.Body(), err); bizErr != nil {
+				return ret, bizErr
+			}
+		}
+		return
+	}
+
+	if unwrap {
+		resp := new(Envelope)
+		if err = json.Unmarshal(body, resp); err != nil {
+			return ret, errno.Wrapf(err, "unmarshal response envelope from [%s %s] err", method, url)
+		}
+		if !IsSucceedCode(resp.Code) {
+			return ret, errno.NewErrno(http.StatusOK, resp.Code, resp.Msg).
+				WithErr(errno.Errorf("do [%s %s] return business_code: %d message: %s", method, url, resp.Code, resp.Msg))
+		}
+		body = resp.Data
+	}
+
+	err = decode(body, &ret)
+	if err != nil {
+		err = errno.Wrapf(err, "unmarshal response from [%s %s] err", method, url)
+	}
+	return
+}
+
+// IsSucceedCode 业务码是否为成功, 兼容使用 0 作为成功码的服务
+func IsSucceedCode(code int) bool {
+	return code == 0 || code == businessCodex.GetSucceedCode()
+}
+
+// ToBusinessErrno 非 200 的响应中如果是 businessCodex.Response 格式并且业务码不是成功码, 转换为 *errno.Errno, 否则返回 nil
+func ToBusinessErrno(httpCode int, body []byte, err error) *errno.Errno {
+	resp := new(Envelope)
+	if len(body) == 0 || json.Unmarshal(body, resp) != nil || IsSucceedCode(resp.Code) {
+		return nil
+	}
+	return errno.NewErrno(httpCode, resp.Code, resp.Msg).WithErr(err)
+}
+
+func toQuery(data interface{}) (httpURL.Values, error) {
+	switch v := data.(type) {
+	case nil:
+		return nil, nil
+	case httpURL.Values:
+		return v, nil
+	case map[string]string:
+		form := make(httpURL.Values, len(v))
+		for key, value := range v {
+			form.Set(key, value)
+		}
+		return form, nil
+	default:
+		return convert.StructToQuery(data)
+	}
+}
+
+func toJSON(data interface{}) (json.RawMessage, error) {
+	switch v := data.(type) {
+	case nil:
+		return nil, nil
+	case json.RawMessage:
+		return v, nil
+	case []byte:
+		return v, nil
+	case string:
+		return json.RawMessage(v), nil
+	default:
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return nil, errno.Wrap(err, "marshal request body err")
+		}
+		return raw, nil
+	}
+}
+
+func decode(body []byte, ret interface{}) error {
+	switch v := ret.(type) {
+	case *[]byte:
+		*v = body
+		return nil
+	case *string:
+		*v = string(body)
+		return nil
+	}
+	if len(body) == 0 || string(body) == "null" {
+		return nil
+	}
+	return json.Unmarshal(body, ret)
+}
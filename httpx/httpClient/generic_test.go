@@ -0,0 +1,74 @@
+package httpClient
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chenxinqun/ginWarpPkg/businessCodex"
+	"github.com/chenxinqun/ginWarpPkg/errno"
+)
+
+type testUser struct {
+	ID   int64  `json:"id" form:"id"`
+	Name string `json:"name" form:"name"`
+}
+
+func TestDo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := new(testUser)
+		if r.Method == http.MethodGet {
+			user.Name = r.URL.Query().Get("name")
+		} else {
+			_ = json.NewDecoder(r.Body).Decode(user)
+		}
+		resp := &businessCodex.Response{Code: businessCodex.GetSucceedCode(), Data: user}
+		if user.Name == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			resp = &businessCodex.Response{Code: 1001, Msg: "name required"}
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	got, err := Get[testUser](srv.URL, testUser{ID: 1, Name: "get"}, WithUnwrap())
+	if err != nil || got.Name != "get" {
+		t.Fatalf("Get() = %+v, %v", got, err)
+	}
+
+	got, err = Post[testUser](srv.URL, &testUser{ID: 2, Name: "post"}, WithUnwrap())
+	if err != nil || got.ID != 2 || got.Name != "post" {
+		t.Fatalf("Post() = %+v, %v", got, err)
+	}
+
+	_, err = Post[testUser](srv.URL, &testUser{ID: 3}, WithUnwrap())
+	var e *errno.Errno
+	if !errors.As(err, &e) || e.GetBusinessCode() != 1001 || e.GetHttpCode() != http.StatusBadRequest || e.GetMsg() != "name required" {
+		t.Fatalf("Post() err = %v, want business errno", err)
+	}
+
+	raw, err := Do[string](http.MethodPut, srv.URL, map[string]string{"name": "put"})
+	if err != nil || raw == "" {
+		t.Fatalf("Do() = %s, %v", raw, err)
+	}
+
+	// 每个 option 只执行一次
+	calls := 0
+	counter := func(opt *option) {
+		calls++
+	}
+	if _, err = Get[testUser](srv.URL, testUser{Name: "once"}, WithUnwrap(), counter); err != nil || calls != 1 {
+		t.Fatalf("option called %d times, err %v", calls, err)
+	}
+
+	// 业务码 0 与 IsSucceedCode 一致, 视为成功
+	zero := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0,"data":{"id":4,"name":"zero"}}`))
+	}))
+	defer zero.Close()
+	if got, err = Get[testUser](zero.URL, testUser{}, WithUnwrap()); err != nil || got.Name != "zero" {
+		t.Fatalf("Get() with code 0 = %+v, %v", got, err)
+	}
+}
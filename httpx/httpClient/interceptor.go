@@ -0,0 +1,266 @@
+package httpClient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/cryptox/signature"
+	"github.com/chenxinqun/ginWarpPkg/httpx/trace"
+	"github.com/chenxinqun/ginWarpPkg/metrics"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultSignHeader DefaultSignDateHeader 签名默认使用的请求头
+	DefaultSignHeader     = "Authorization"
+	DefaultSignDateHeader = "Authorization-Date"
+	// DefaultRequestIDHeader 默认的请求ID请求头
+	DefaultRequestIDHeader = "X-Request-ID"
+	// tokenRefreshAhead token 过期前提前刷新的时间
+	tokenRefreshAhead = 30 * time.Second
+)
+
+// RoundTripperFunc 函数形式的 http.RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Interceptor 请求拦截器, 包装下一级的 RoundTripper, 可以修改请求, 响应, 或者直接返回.
+// 重试时每次请求都会经过拦截器.
+type Interceptor func(next http.RoundTripper) http.RoundTripper
+
+// WithInterceptor 添加请求拦截器, 可以调用多次, 先添加的在外层先执行.
+func WithInterceptor(interceptors ...Interceptor) OptionHandler {
+	return func(opt *option) {
+		opt.interceptors = append(opt.interceptors, interceptors...)
+	}
+}
+
+// chainClient 在 client 的 Transport 外包装拦截器
+func chainClient(client *http.Client, interceptors []Interceptor) *http.Client {
+	if len(interceptors) == 0 {
+		return client
+	}
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		next = interceptors[i](next)
+	}
+	chained := *client
+	chained.Transport = next
+	return &chained
+}
+
+// SignatureInterceptor 使用 cryptox/signature 对请求签名, 签名参数为 query 参数和 form 表单参数.
+// authorizationHeader 和 dateHeader 不填时使用 DefaultSignHeader 和 DefaultSignDateHeader.
+func SignatureInterceptor(sign signature.Signature, authorizationHeader, dateHeader string) Interceptor {
+	if authorizationHeader == "" {
+		authorizationHeader = DefaultSignHeader
+	}
+	if dateHeader == "" {
+		dateHeader = DefaultSignDateHeader
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			params := req.URL.Query()
+			if strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+				raw, err := readBody(req)
+				if err != nil {
+					return nil, err
+				}
+				form, err := url.ParseQuery(string(raw))
+				if err != nil {
+					return nil, errors.Wrap(err, "parse form body for signature err")
+				}
+				for key, values := range form {
+					params[key] = append(params[key], values...)
+				}
+			}
+
+			path := req.URL.Path
+			if path == "" {
+				path = "/"
+			}
+			authorization, date, err := sign.Generate(path, req.Method, params)
+			if err != nil {
+				return nil, errors.Wrap(err, "generate signature err")
+			}
+			req.Header.Set(authorizationHeader, authorization)
+			req.Header.Set(dateHeader, date)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// TokenFetcher 获取 token 及其过期时间
+type TokenFetcher func(ctx context.Context) (token string, expireAt time.Time, err error)
+
+// tokenCache 缓存 token, 过期前或服务端返回 401 时重新获取
+type tokenCache struct {
+	mu       sync.Mutex
+	fetch    TokenFetcher
+	token    string
+	expireAt time.Time
+}
+
+func (c *tokenCache) get(ctx context.Context, refresh bool) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !refresh && c.token != "" && time.Now().Add(tokenRefreshAhead).Before(c.expireAt) {
+		return c.token, nil
+	}
+	token, expireAt, err := c.fetch(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "fetch bearer token err")
+	}
+	c.token, c.expireAt = token, expireAt
+	return token, nil
+}
+
+// BearerTokenInterceptor 在请求头中添加 Authorization: Bearer token.
+// token 在过期前自动刷新, 服务端返回 401 时会刷新 token 并重新请求一次.
+func BearerTokenInterceptor(fetch TokenFetcher) Interceptor {
+	cache := &tokenCache{fetch: fetch}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			send := func(refresh bool) (*http.Response, error) {
+				token, err := cache.get(req.Context(), refresh)
+				if err != nil {
+					return nil, err
+				}
+				r := req.Clone(req.Context())
+				if req.GetBody != nil {
+					if r.Body, err = req.GetBody(); err != nil {
+						return nil, err
+					}
+				}
+				r.Header.Set("Authorization", "Bearer "+token)
+				return next.RoundTrip(r)
+			}
+
+			resp, err := send(false)
+			// 请求体不能重复读取时, 不再重新请求
+			if err != nil || resp.StatusCode != http.StatusUnauthorized || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+				return resp, err
+			}
+			resp.Body.Close()
+			return send(true)
+		})
+	}
+}
+
+// RequestIDInterceptor 请求头中没有请求ID时生成一个, header 不填时使用 DefaultRequestIDHeader.
+func RequestIDInterceptor(header string) Interceptor {
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(header) == "" {
+				req = req.Clone(req.Context())
+				req.Header.Set(header, trace.NewSpanID())
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// TraceInterceptor 从请求的 context 中获取 trace, 把链路ID和一个新的调用点ID写入请求头.
+func TraceInterceptor() Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if t := trace.FromContext(req.Context()); t != nil {
+				req = req.Clone(req.Context())
+				req.Header.Set(trace.Header, t.ID())
+				req.Header.Set(trace.SpanHeader, trace.NewSpanID())
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// MetricsInterceptor 记录对外请求的指标, 与 httpClient 发出的请求使用同样的指标和标签.
+// 用于不经过 httpClient 发送, 但使用注册的客户端的请求, 如反向代理.
+func MetricsInterceptor() Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			ts := time.Now()
+			done := metrics.ClientInFlight(req.URL.Host, req.Method)
+			resp, err := next.RoundTrip(req)
+			done()
+			var statusCode int
+			if err == nil {
+				statusCode = resp.StatusCode
+			}
+			metrics.RecordClientMetrics(req.URL.Host, req.Method, normalizePath(req.URL.Path), statusClass(statusCode), time.Since(ts).Seconds())
+			return resp, err
+		})
+	}
+}
+
+// GzipInterceptor 请求体不小于 minSize 字节时使用 gzip 压缩, 并设置 Content-Encoding: gzip.
+func GzipInterceptor(minSize int) Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Body == nil || req.Body == http.NoBody || req.Header.Get("Content-Encoding") != "" {
+				return next.RoundTrip(req)
+			}
+			req = req.Clone(req.Context())
+			raw, err := readBody(req)
+			if err != nil {
+				return nil, err
+			}
+			if len(raw) < minSize {
+				return next.RoundTrip(req)
+			}
+
+			buf := new(bytes.Buffer)
+			zw := gzip.NewWriter(buf)
+			if _, err = zw.Write(raw); err != nil {
+				return nil, errors.Wrap(err, "gzip request body err")
+			}
+			if err = zw.Close(); err != nil {
+				return nil, errors.Wrap(err, "gzip request body err")
+			}
+			setBody(req, buf.Bytes())
+			req.Header.Set("Content-Encoding", "gzip")
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// readBody 读取请求体, 并把请求体恢复成可以再次读取的状态, 调用前需要先 Clone 请求
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	raw, err := ioutil.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "read request body err")
+	}
+	setBody(req, raw)
+	return raw, nil
+}
+
+func setBody(req *http.Request, raw []byte) {
+	req.Body = ioutil.NopCloser(bytes.NewReader(raw))
+	req.ContentLength = int64(len(raw))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(raw)), nil
+	}
+}
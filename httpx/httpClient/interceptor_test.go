@@ -0,0 +1,88 @@
+package httpClient
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/cryptox/signature"
+	"github.com/chenxinqun/ginWarpPkg/httpx/trace"
+)
+
+func TestInterceptors(t *testing.T) {
+	var (
+		fetched int
+		tokens  = []string{"expired", "fresh"}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("X-Signature") == "" || r.Header.Get(DefaultSignDateHeader) == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body := r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = zr
+		}
+		raw, _ := ioutil.ReadAll(body)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"body":       string(raw),
+			"request_id": r.Header.Get(DefaultRequestIDHeader),
+			"trace_id":   r.Header.Get(trace.Header),
+		})
+	}))
+	defer srv.Close()
+
+	fetch := func(ctx context.Context) (string, time.Time, error) {
+		token := tokens[fetched%len(tokens)]
+		fetched++
+		return token, time.Now().Add(time.Hour), nil
+	}
+
+	bearer := BearerTokenInterceptor(fetch)
+	x := trace.New("")
+	payload := `{"name":"` + strings.Repeat("x", 100) + `"}`
+	got, err := Post[map[string]string](srv.URL, json.RawMessage(payload),
+		WithContext(trace.NewContext(context.Background(), x)),
+		WithInterceptor(
+			RequestIDInterceptor(""),
+			TraceInterceptor(),
+			SignatureInterceptor(signature.New("key", "secret", time.Minute), "X-Signature", ""),
+			bearer,
+			GzipInterceptor(64),
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["body"] != payload || got["request_id"] == "" || got["trace_id"] != x.ID() {
+		t.Errorf("Post() = %v", got)
+	}
+	if fetched != 2 {
+		t.Errorf("token fetched %d times, want 2", fetched)
+	}
+
+	// token 已缓存, 不再重新获取
+	form := url.Values{"a": {"1"}}
+	if _, _, err = PostForm(srv.URL, form, WithInterceptor(SignatureInterceptor(signature.New("key", "secret", time.Minute), "X-Signature", ""), bearer)); err != nil {
+		t.Fatal(err)
+	}
+	if fetched != 2 {
+		t.Errorf("token fetched %d times, want 2", fetched)
+	}
+}
@@ -0,0 +1,103 @@
+package httpClient
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	idSegment = ":id"
+	// maxUnmatchedSegments 没有匹配到模板的路径最多保留的段数, 多出的段合并为 *
+	maxUnmatchedSegments = 2
+)
+
+var (
+	templatesMu sync.RWMutex
+	templates   [][]string
+)
+
+// RegisterPathTemplate 注册路径模板, 记录指标时把匹配的路径归一化为模板, 避免指标的 path 标签无限增长.
+// 模板中以 : 或 { 开头的段匹配任意值, * 匹配剩余的所有段, 如 /user/:id, /user/{id}/orders, /static/*.
+// 没有匹配到模板的路径, 会把数字, UUID 之类的段替换为 :id, 并且只保留前两段, 之后的段合并为 *, 如 /order/:id/*.
+func RegisterPathTemplate(pathTemplates ...string) {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+	for _, t := range pathTemplates {
+		templates = append(templates, splitPath(t))
+	}
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// normalizePath 把请求路径归一化为路径模板
+func normalizePath(path string) string {
+	segments := splitPath(path)
+
+	templatesMu.RLock()
+	for _, t := range templates {
+		if matchTemplate(t, segments) {
+			templatesMu.RUnlock()
+			return "/" + strings.Join(t, "/")
+		}
+	}
+	templatesMu.RUnlock()
+
+	if len(segments) > maxUnmatchedSegments {
+		segments = append(segments[:maxUnmatchedSegments], "*")
+	}
+	for i, seg := range segments {
+		if isIDSegment(seg) {
+			segments[i] = idSegment
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+func matchTemplate(template, segments []string) bool {
+	for i, t := range template {
+		if t == "*" {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if strings.HasPrefix(t, ":") || strings.HasPrefix(t, "{") {
+			continue
+		}
+		if t != segments[i] {
+			return false
+		}
+	}
+	return len(template) == len(segments)
+}
+
+// isIDSegment 判断路径段是否像一个ID: 纯数字, UUID, 或者较长的十六进制字符串
+func isIDSegment(seg string) bool {
+	if seg == "" {
+		return false
+	}
+	if _, err := strconv.ParseInt(seg, 10, 64); err == nil {
+		return true
+	}
+	hex := strings.ReplaceAll(seg, "-", "")
+	if len(hex) < 16 {
+		return false
+	}
+	for _, c := range hex {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// statusClass 状态码分类, 如 2xx, 5xx, 没有响应时为 error
+func statusClass(httpCode int) string {
+	if httpCode < 100 {
+		return "error"
+	}
+	return strconv.Itoa(httpCode/100) + "xx"
+}
@@ -0,0 +1,23 @@
+package httpClient
+
+import "testing"
+
+func TestNormalizePath(t *testing.T) {
+	RegisterPathTemplate("/user/:name/orders", "/static/*")
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/user/tom/orders", "/user/:name/orders"},
+		{"/static/js/app.js", "/static/*"},
+		{"/order/10086", "/order/:id"},
+		{"/order/3f2a1b4c-5d6e-4f70-8a9b-0c1d2e3f4a5b/items", "/order/:id/*"},
+		{"/files/a/b/report.pdf", "/files/a/*"},
+		{"/health", "/health"},
+	}
+	for _, tt := range tests {
+		if got := normalizePath(tt.path); got != tt.want {
+			t.Errorf("normalizePath(%s) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
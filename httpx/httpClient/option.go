@@ -1,6 +1,9 @@
 package httpClient
 
 import (
+	"context"
+
+	"github.com/chenxinqun/ginWarpPkg/httpx/breaker"
 	"github.com/chenxinqun/ginWarpPkg/httpx/trace"
 	"sync"
 	"time"
@@ -25,15 +28,22 @@ type Mock func() (body []byte)
 type OptionHandler func(*option)
 
 type option struct {
-	ttl         time.Duration
-	header      map[string][]string
-	trace       *trace.Trace
-	dialog      *trace.Dialog
-	logger      *zap.Logger
-	alarmTitle  string
-	alarmObject AlarmObject
-	alarmVerify AlarmVerify
-	mock        Mock
+	ttl          time.Duration
+	header       map[string][]string
+	trace        *trace.Trace
+	dialog       *trace.Dialog
+	logger       *zap.Logger
+	alarmTitle   string
+	alarmObject  AlarmObject
+	alarmVerify  AlarmVerify
+	mock         Mock
+	profile      string
+	ctx          context.Context
+	retry        *RetryPolicy
+	unwrap       bool
+	progress     Progress
+	interceptors []Interceptor
+	breaker      *breaker.Group
 }
 
 func (o *option) reset() {
@@ -46,6 +56,13 @@ func (o *option) reset() {
 	o.alarmObject = nil
 	o.alarmVerify = nil
 	o.mock = nil
+	o.profile = ""
+	o.ctx = nil
+	o.retry = nil
+	o.unwrap = false
+	o.progress = nil
+	o.interceptors = nil
+	o.breaker = nil
 }
 
 func getOption() *option {
@@ -57,6 +74,13 @@ func releaseOption(opt *option) {
 	cache.Put(opt)
 }
 
+func (o *option) parentContext() context.Context {
+	if o.ctx != nil {
+		return o.ctx
+	}
+	return context.Background()
+}
+
 // WithTTL 本次http请求最长执行时间.
 func WithTTL(ttl time.Duration) OptionHandler {
 	return func(opt *option) {
@@ -81,6 +105,27 @@ func WithTrace(t trace.T) OptionHandler {
 	}
 }
 
+// WithContext 使用调用方的 context 发起请求, 调用方取消时请求也会被取消.
+// 如果 context 中携带了 trace, 并且没有使用 WithTrace, 则自动记录到这个 trace 中.
+func WithContext(ctx context.Context) OptionHandler {
+	return func(opt *option) {
+		opt.ctx = ctx
+		if opt.trace == nil {
+			if t, ok := trace.FromContext(ctx).(*trace.Trace); ok {
+				opt.trace = t
+				opt.dialog = new(trace.Dialog)
+			}
+		}
+	}
+}
+
+// WithRetry 设置重试策略, 默认只重试幂等的请求, 每次请求都会记录到 trace 中.
+func WithRetry(policy RetryPolicy) OptionHandler {
+	return func(opt *option) {
+		opt.retry = &policy
+	}
+}
+
 // WithLogger 设置logger以便打印关键日志.
 func WithLogger(logger *zap.Logger) OptionHandler {
 	return func(opt *option) {
@@ -95,7 +140,7 @@ func WithMock(m Mock) OptionHandler {
 	}
 }
 
-// WithOnFailedAlarm 设置告警通知.
+// WithOnFailedAlarm 设置告警通知, 每次失败都会调用 alarmObject, 建议使用 alarm.NewThrottle 包装避免告警刷屏.
 func WithOnFailedAlarm(alarmTitle string, alarmObject AlarmObject, alarmVerify AlarmVerify) OptionHandler {
 	return func(opt *option) {
 		opt.alarmTitle = alarmTitle
@@ -103,3 +148,18 @@ func WithOnFailedAlarm(alarmTitle string, alarmObject AlarmObject, alarmVerify A
 		opt.alarmVerify = alarmVerify
 	}
 }
+
+// WithProfile 使用 RegisterProfile 注册的客户端配置发起请求.
+func WithProfile(name string) OptionHandler {
+	return func(opt *option) {
+		opt.profile = name
+	}
+}
+
+// WithBreaker 按域名熔断, 熔断器打开时直接返回 breaker.NewOpenErrno 的错误, 或者配置的降级内容.
+// 请求出错或者响应状态码 >= 500 算作失败.
+func WithBreaker(g *breaker.Group) OptionHandler {
+	return func(opt *option) {
+		opt.breaker = g
+	}
+}
@@ -0,0 +1,139 @@
+package httpClient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultRetryInitialBackoff = 100 * time.Millisecond
+	DefaultRetryMaxBackoff     = 5 * time.Second
+	DefaultRetryMultiplier     = 2
+	DefaultRetryJitter         = 0.2
+)
+
+// DefaultRetryableCodes 默认需要重试的 HTTP 状态码
+var DefaultRetryableCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryPolicy 重试策略, 配合 WithRetry 使用. 数值类的字段不填时使用默认值.
+type RetryPolicy struct {
+	// MaxAttempts 最多请求次数(包含第一次请求), 小于 2 时不重试
+	MaxAttempts int
+	// InitialBackoff 第一次重试前的等待时间
+	InitialBackoff time.Duration
+	// MaxBackoff 重试前的最长等待时间, 服务端返回的 Retry-After 也受这个限制
+	MaxBackoff time.Duration
+	// Multiplier 每次重试等待时间的增长倍数
+	Multiplier float64
+	// Jitter 等待时间的随机抖动比例, 取值 0 ~ 1
+	Jitter float64
+	// RetryableCodes 需要重试的 HTTP 状态码, 不填使用 DefaultRetryableCodes
+	RetryableCodes []int
+	// Force 非幂等的请求(POST, PATCH)也进行重试, 需要确认服务端能处理重复请求
+	Force bool
+}
+
+func (p RetryPolicy) normalize() RetryPolicy {
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryMaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = DefaultRetryMultiplier
+	}
+	if p.Jitter <= 0 || p.Jitter > 1 {
+		p.Jitter = DefaultRetryJitter
+	}
+	if len(p.RetryableCodes) == 0 {
+		p.RetryableCodes = DefaultRetryableCodes
+	}
+	return p
+}
+
+// backoff 第 attempt 次请求失败后, 重试前的等待时间
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	wait := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if wait > float64(p.MaxBackoff) {
+		wait = float64(p.MaxBackoff)
+	}
+	wait += wait * p.Jitter * (rand.Float64()*2 - 1)
+	return time.Duration(wait)
+}
+
+func (p RetryPolicy) shouldRetry(method string, httpCode int, err error) bool {
+	if !p.Force && !isIdempotent(method) {
+		return false
+	}
+	if e, ok := ToReplyErr(err); ok {
+		for _, code := range p.RetryableCodes {
+			if e.StatusCode() == code {
+				return true
+			}
+		}
+		return false
+	}
+	return isRetryableError(err)
+}
+
+// isIdempotent 幂等的请求方法, 重复请求不会产生副作用
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isRetryableError 网络错误是否可以重试, 调用方取消或超时的不重试
+func isRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout()
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// retryAfter 解析服务端返回的 Retry-After, 支持秒数和 HTTP 时间两种格式
+func retryAfter(err error) (time.Duration, bool) {
+	e, ok := err.(*replyError)
+	if !ok || e.header == nil {
+		return 0, false
+	}
+	value := e.header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, e := strconv.Atoi(value); e == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, e := http.ParseTime(value); e == nil {
+		return time.Until(date), true
+	}
+	return 0, false
+}
@@ -0,0 +1,64 @@
+package httpClient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/httpx/trace"
+)
+
+func TestWithRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1)%3 != 0 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	x := trace.New("")
+	ctx := trace.NewContext(context.Background(), x)
+	body, code, err := GetJson(srv.URL, url.Values{}, WithContext(ctx), WithRetry(policy))
+	if err != nil || code != http.StatusOK || string(body) != "ok" {
+		t.Fatalf("GetJson() = %s, %d, %v", body, code, err)
+	}
+	if len(x.ThirdPartyRequests) != 1 || len(x.ThirdPartyRequests[0].Responses) != 3 {
+		t.Fatalf("every attempt should be recorded, got %+v", x.ThirdPartyRequests)
+	}
+
+	// 非幂等请求默认不重试
+	atomic.StoreInt32(&calls, 0)
+	if _, _, err = PostJSON(srv.URL, json.RawMessage(`{}`), WithRetry(policy)); err == nil {
+		t.Fatal("post should not be retried")
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("post called %d times, want 1", n)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	policy.Force = true
+	if _, _, err = PostJSON(srv.URL, json.RawMessage(`{}`), WithRetry(policy)); err != nil {
+		t.Fatalf("forced post retry got err: %v", err)
+	}
+
+	// 调用方取消后不再发起请求
+	atomic.StoreInt32(&calls, 0)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err = GetJson(srv.URL, url.Values{}, WithContext(cancelled), WithRetry(policy)); err == nil {
+		t.Fatal("cancelled context should return err")
+	}
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Fatalf("cancelled request called %d times, want 0", n)
+	}
+}
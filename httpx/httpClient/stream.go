@@ -0,0 +1,250 @@
+package httpClient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	httpURL "net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/errno"
+	"github.com/chenxinqun/ginWarpPkg/httpx/trace"
+
+	"github.com/pkg/errors"
+)
+
+// Progress 上传或下载的进度回调, total 未知时为 -1
+type Progress func(done, total int64)
+
+// WithProgress 设置上传(PostMultipart)或下载(Download)的进度回调.
+func WithProgress(p Progress) OptionHandler {
+	return func(opt *option) {
+		opt.progress = p
+	}
+}
+
+// progressCounter 多个 reader 共用一个计数, 用于多文件上传时统计总进度
+type progressCounter struct {
+	done  int64
+	total int64
+	fn    Progress
+}
+
+func (c *progressCounter) wrap(r io.Reader) io.Reader {
+	return &progressReader{r: r, counter: c}
+}
+
+type progressReader struct {
+	r       io.Reader
+	counter *progressCounter
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.counter.fn(atomic.AddInt64(&p.counter.done, int64(n)), p.counter.total)
+	}
+	return n, err
+}
+
+func newProgressReader(r io.Reader, total int64, fn Progress) io.Reader {
+	return (&progressCounter{total: total, fn: fn}).wrap(r)
+}
+
+// MultipartFile multipart 上传的文件
+type MultipartFile struct {
+	FieldName   string
+	FileName    string
+	ContentType string // 不填默认 application/octet-stream
+	Reader      io.Reader
+	Size        int64 // 文件大小, 用于计算上传进度, 不知道时填 0
+}
+
+// PostMultipart multipart/form-data 上传文件, 文件内容从 Reader 中流式读取.
+// 文件内容只能读取一次, 所以不会按 WithRetry 的策略重试, trace 中只记录文件的元信息.
+func PostMultipart(url string, fields httpURL.Values, files []MultipartFile, options ...OptionHandler) (body []byte, httpCode int, err error) {
+	if url == "" {
+		return nil, 0, errno.NewError("url required")
+	}
+	if len(files) == 0 && len(fields) == 0 {
+		return nil, 0, errno.NewError("files or fields required")
+	}
+
+	ts := time.Now()
+
+	opt := getOption()
+	defer func() {
+		if opt.trace != nil {
+			opt.dialog.Success = err == nil
+			opt.dialog.CostSeconds = time.Since(ts).Seconds()
+			opt.trace.AppendDialog(opt.dialog)
+		}
+
+		releaseOption(opt)
+	}()
+
+	for _, f := range options {
+		f(opt)
+	}
+	opt.retry = nil
+
+	boundary := multipart.NewWriter(nil).Boundary()
+	opt.header["Content-Type"] = []string{"multipart/form-data; boundary=" + boundary}
+	if opt.trace != nil {
+		opt.header[trace.Header] = []string{opt.trace.ID()}
+	}
+
+	ttl := opt.ttl
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	ctx, cancel := context.WithTimeout(opt.parentContext(), ttl)
+	defer cancel()
+
+	var counter *progressCounter
+	if opt.progress != nil {
+		counter = &progressCounter{total: -1, fn: opt.progress}
+		var total int64
+		for _, file := range files {
+			if file.Size <= 0 {
+				total = -1
+				break
+			}
+			total += file.Size
+		}
+		counter.total = total
+	}
+
+	if opt.dialog != nil {
+		meta := make([]map[string]interface{}, 0, len(files))
+		for _, file := range files {
+			meta = append(meta, map[string]interface{}{
+				"field_name":   file.FieldName,
+				"file_name":    file.FileName,
+				"content_type": file.ContentType,
+				"size":         file.Size,
+			})
+		}
+		decodedURL, _ := httpURL.QueryUnescape(url)
+		opt.dialog.Request = &trace.Request{
+			TTL:        ttl.String(),
+			Method:     http.MethodPost,
+			DecodedURL: decodedURL,
+			Header:     opt.header,
+			Body: map[string]interface{}{
+				"fields": fields,
+				"files":  meta,
+			},
+		}
+	}
+
+	newBody := func() (io.Reader, error) {
+		pr, pw := io.Pipe()
+		mw := multipart.NewWriter(pw)
+		if err := mw.SetBoundary(boundary); err != nil {
+			return nil, err
+		}
+		go func() {
+			pw.CloseWithError(writeMultipart(mw, fields, files, counter))
+		}()
+		return pr, nil
+	}
+
+	body, httpCode, _, err = doRequest(ctx, http.MethodPost, url, newBody, nil, opt)
+	return
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func writeMultipart(mw *multipart.Writer, fields httpURL.Values, files []MultipartFile, counter *progressCounter) error {
+	for key, values := range fields {
+		for _, value := range values {
+			if err := mw.WriteField(key, value); err != nil {
+				return err
+			}
+		}
+	}
+	for _, file := range files {
+		if file.Reader == nil {
+			return errors.Errorf("reader of file `%s` required", file.FileName)
+		}
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			quoteEscaper.Replace(file.FieldName), quoteEscaper.Replace(file.FileName)))
+		header.Set("Content-Type", contentType)
+		part, err := mw.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		var src = file.Reader
+		if counter != nil {
+			src = counter.wrap(src)
+		}
+		if _, err = io.Copy(part, src); err != nil {
+			return errors.Wrapf(err, "read file `%s` err", file.FileName)
+		}
+	}
+	return mw.Close()
+}
+
+// Download 下载文件, 响应内容流式写入 w, 不会整个读入内存, trace 中只记录响应的元信息.
+// 配合 WithRetry 使用时, 只有还没有写入任何内容时才会重试.
+func Download(url string, w io.Writer, options ...OptionHandler) (written int64, httpCode int, err error) {
+	if url == "" {
+		return 0, 0, errno.NewError("url required")
+	}
+	if w == nil {
+		return 0, 0, errno.NewError("writer required")
+	}
+
+	ts := time.Now()
+
+	opt := getOption()
+	defer func() {
+		if opt.trace != nil {
+			opt.dialog.Success = err == nil
+			opt.dialog.CostSeconds = time.Since(ts).Seconds()
+			opt.trace.AppendDialog(opt.dialog)
+		}
+
+		releaseOption(opt)
+	}()
+
+	for _, f := range options {
+		f(opt)
+	}
+	if opt.trace != nil {
+		opt.header[trace.Header] = []string{opt.trace.ID()}
+	}
+
+	ttl := opt.ttl
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	ctx, cancel := context.WithTimeout(opt.parentContext(), ttl)
+	defer cancel()
+
+	if opt.dialog != nil {
+		decodedURL, _ := httpURL.QueryUnescape(url)
+		opt.dialog.Request = &trace.Request{
+			TTL:        ttl.String(),
+			Method:     http.MethodGet,
+			DecodedURL: decodedURL,
+			Header:     opt.header,
+		}
+	}
+
+	_, httpCode, written, err = doRequest(ctx, http.MethodGet, url, bytesBody(nil), w, opt)
+	return
+}
@@ -0,0 +1,91 @@
+package httpClient
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/httpx/breaker"
+	"github.com/chenxinqun/ginWarpPkg/httpx/trace"
+)
+
+func TestPostMultipartAndDownload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(bytes.Repeat([]byte("x"), 1024))
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		content, _ := ioutil.ReadAll(file)
+		_, _ = w.Write([]byte(r.FormValue("name") + ":" + header.Filename + ":" + string(content)))
+	}))
+	defer srv.Close()
+
+	var uploaded int64
+	content := "hello multipart"
+	body, code, err := PostMultipart(srv.URL, url.Values{"name": {"test"}}, []MultipartFile{{
+		FieldName: "file",
+		FileName:  "a.txt",
+		Reader:    strings.NewReader(content),
+		Size:      int64(len(content)),
+	}}, WithProgress(func(done, total int64) { uploaded = done }))
+	if err != nil || code != http.StatusOK || string(body) != "test:a.txt:"+content {
+		t.Fatalf("PostMultipart() = %s, %d, %v", body, code, err)
+	}
+	if uploaded != int64(len(content)) {
+		t.Errorf("upload progress = %d, want %d", uploaded, len(content))
+	}
+
+	x := trace.New("")
+	buf := new(bytes.Buffer)
+	written, code, err := Download(srv.URL, buf, WithTrace(x))
+	if err != nil || code != http.StatusOK || written != 1024 || buf.Len() != 1024 {
+		t.Fatalf("Download() = %d, %d, %v", written, code, err)
+	}
+	resp := x.ThirdPartyRequests[0].Responses[0]
+	if _, ok := resp.Body.(map[string]interface{}); !ok {
+		t.Errorf("download trace body should be metadata, got %T", resp.Body)
+	}
+}
+
+// 请求没有发出就返回时, 写入 multipart 请求体的协程不能泄漏
+func TestPostMultipartNoLeak(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	g := breaker.NewGroup(breaker.Config{Name: "leak", WindowSize: 1, MinRequests: 1, OpenTimeout: time.Minute})
+	u, _ := url.Parse(srv.URL)
+	g.Get(u.Host).Done(false, 0)
+
+	content := strings.Repeat("x", 1<<20)
+	files := func() []MultipartFile {
+		return []MultipartFile{{FieldName: "file", FileName: "a.txt", Reader: strings.NewReader(content)}}
+	}
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		if _, code, err := PostMultipart(srv.URL, nil, files(), WithBreaker(g)); !breaker.IsOpenErr(err) || code != http.StatusServiceUnavailable {
+			t.Fatalf("PostMultipart() with open breaker = %d, %v", code, err)
+		}
+		if _, _, err := PostMultipart(srv.URL, nil, files(), WithProfile("not-exists")); err == nil {
+			t.Fatal("PostMultipart() with unknown profile should fail")
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("goroutines leaked: before %d, after %d", before, n)
+	}
+}
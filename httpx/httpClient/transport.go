@@ -0,0 +1,301 @@
+package httpClient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultProfile 默认的客户端配置名称, 不使用 WithProfile 时使用这个配置
+	DefaultProfile = "default"
+
+	// ProxyFromEnvironment Profile.Proxy 填这个值时, 从 HTTP_PROXY, HTTPS_PROXY, NO_PROXY 环境变量中读取代理
+	ProxyFromEnvironment = "env"
+
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 100
+	DefaultMaxConnsPerHost     = 100
+	DefaultDialTimeout         = 10 * time.Second
+	DefaultKeepAlive           = 30 * time.Second
+	DefaultTLSHandshakeTimeout = 10 * time.Second
+	DefaultIdleConnTimeout     = 90 * time.Second
+)
+
+// Profile http客户端的连接配置, 使用 RegisterProfile 注册后, 请求时通过 WithProfile 选择.
+// 数值类的字段不填时使用默认值.
+type Profile struct {
+	Name string `toml:"name" json:"name"`
+
+	// DisableKeepAlives 关闭连接复用, 每次请求都重新建立连接
+	DisableKeepAlives   bool `toml:"disableKeepAlives" json:"disableKeepAlives"`
+	MaxIdleConns        int  `toml:"maxIdleConns" json:"maxIdleConns"`
+	MaxIdleConnsPerHost int  `toml:"maxIdleConnsPerHost" json:"maxIdleConnsPerHost"`
+	MaxConnsPerHost     int  `toml:"maxConnsPerHost" json:"maxConnsPerHost"`
+	// DisableHTTP2 关闭 HTTP/2, 只使用 HTTP/1.1
+	DisableHTTP2       bool `toml:"disableHTTP2" json:"disableHTTP2"`
+	DisableCompression bool `toml:"disableCompression" json:"disableCompression"`
+
+	// Proxy 代理地址, 支持 http://, https://, socks5:// 格式, 填 env 时从环境变量读取
+	Proxy string `toml:"proxy" json:"proxy"`
+	// DNSCacheTTL 域名解析结果的缓存时间, 不填则不缓存
+	DNSCacheTTL time.Duration `toml:"dnsCacheTTL" json:"dnsCacheTTL"`
+
+	// CAFile 自定义 CA 证书文件(PEM 格式), 会追加到系统证书池中
+	CAFile string `toml:"caFile" json:"caFile"`
+	// CertFile KeyFile mTLS 的客户端证书和私钥
+	CertFile string `toml:"certFile" json:"certFile"`
+	KeyFile  string `toml:"keyFile" json:"keyFile"`
+	// ServerName 校验服务端证书时使用的域名, 不填则使用请求地址中的域名
+	ServerName string `toml:"serverName" json:"serverName"`
+	// InsecureSkipVerify 跳过服务端证书校验, 仅用于测试环境
+	InsecureSkipVerify bool `toml:"insecureSkipVerify" json:"insecureSkipVerify"`
+
+	DialTimeout           time.Duration `toml:"dialTimeout" json:"dialTimeout"`
+	KeepAlive             time.Duration `toml:"keepAlive" json:"keepAlive"`
+	TLSHandshakeTimeout   time.Duration `toml:"tlsHandshakeTimeout" json:"tlsHandshakeTimeout"`
+	IdleConnTimeout       time.Duration `toml:"idleConnTimeout" json:"idleConnTimeout"`
+	ResponseHeaderTimeout time.Duration `toml:"responseHeaderTimeout" json:"responseHeaderTimeout"`
+}
+
+func (p *Profile) setDefaults() {
+	if p.Name == "" {
+		p.Name = DefaultProfile
+	}
+	if p.MaxIdleConns <= 0 {
+		p.MaxIdleConns = DefaultMaxIdleConns
+	}
+	if p.MaxIdleConnsPerHost <= 0 {
+		p.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	if p.MaxConnsPerHost <= 0 {
+		p.MaxConnsPerHost = DefaultMaxConnsPerHost
+	}
+	if p.DialTimeout <= 0 {
+		p.DialTimeout = DefaultDialTimeout
+	}
+	if p.KeepAlive <= 0 {
+		p.KeepAlive = DefaultKeepAlive
+	}
+	if p.TLSHandshakeTimeout <= 0 {
+		p.TLSHandshakeTimeout = DefaultTLSHandshakeTimeout
+	}
+	if p.IdleConnTimeout <= 0 {
+		p.IdleConnTimeout = DefaultIdleConnTimeout
+	}
+}
+
+var (
+	profilesMu sync.RWMutex
+	profiles   = map[string]*http.Client{}
+)
+
+func init() {
+	client, err := NewClient(Profile{Name: DefaultProfile, DisableCompression: true})
+	if err != nil {
+		panic(err)
+	}
+	profiles[DefaultProfile] = client
+}
+
+// RegisterProfile 根据配置创建客户端并注册, 同名的配置会被替换.
+func RegisterProfile(p Profile) error {
+	client, err := NewClient(p)
+	if err != nil {
+		return err
+	}
+	if p.Name == "" {
+		p.Name = DefaultProfile
+	}
+
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	if old, ok := profiles[p.Name]; ok {
+		old.CloseIdleConnections()
+	}
+	profiles[p.Name] = client
+	return nil
+}
+
+// RegisterProfileClient 直接注册一个 http.Client, 如测试时使用 cassette 录制回放的客户端替换默认客户端
+func RegisterProfileClient(name string, client *http.Client) {
+	if name == "" {
+		name = DefaultProfile
+	}
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	profiles[name] = client
+}
+
+// GetProfileClient 获取已注册的客户端
+func GetProfileClient(name string) (*http.Client, error) {
+	if name == "" {
+		name = DefaultProfile
+	}
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+	client, ok := profiles[name]
+	if !ok {
+		return nil, errors.Errorf("http client profile `%s` not registered", name)
+	}
+	return client, nil
+}
+
+// NewClient 根据配置创建一个 http.Client, 超时时间由每次请求的 context 控制
+func NewClient(p Profile) (*http.Client, error) {
+	p.setDefaults()
+
+	tlsConfig, err := newTLSConfig(p)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   p.DialTimeout,
+		KeepAlive: p.KeepAlive,
+	}
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		DisableKeepAlives:     p.DisableKeepAlives,
+		DisableCompression:    p.DisableCompression,
+		ForceAttemptHTTP2:     !p.DisableHTTP2,
+		MaxIdleConns:          p.MaxIdleConns,
+		MaxIdleConnsPerHost:   p.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       p.MaxConnsPerHost,
+		IdleConnTimeout:       p.IdleConnTimeout,
+		TLSHandshakeTimeout:   p.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: p.ResponseHeaderTimeout,
+	}
+	if p.DisableHTTP2 {
+		// TLSNextProto 不为 nil 时, 不会再协商 HTTP/2
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	if p.DNSCacheTTL > 0 {
+		transport.DialContext = newDNSCache(p.DNSCacheTTL).dialContext(dialer)
+	}
+
+	switch p.Proxy {
+	case "":
+	case ProxyFromEnvironment:
+		transport.Proxy = http.ProxyFromEnvironment
+	default:
+		proxyURL, err := url.Parse(p.Proxy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse proxy `%s` err", p.Proxy)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, errors.Errorf("unsupported proxy scheme `%s`", proxyURL.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+func newTLSConfig(p Profile) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         p.ServerName,
+		InsecureSkipVerify: p.InsecureSkipVerify,
+	}
+
+	if p.CAFile != "" {
+		pem, err := ioutil.ReadFile(p.CAFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read ca file `%s` err", p.CAFile)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificate found in ca file `%s`", p.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if p.CertFile != "" || p.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(p.CertFile, p.KeyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "load client certificate `%s` `%s` err", p.CertFile, p.KeyFile)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+type dnsEntry struct {
+	addrs  []string
+	expire time.Time
+}
+
+// dnsCache 缓存域名解析结果, 避免每次建立连接都去解析域名
+type dnsCache struct {
+	ttl   time.Duration
+	mu    sync.RWMutex
+	hosts map[string]dnsEntry
+}
+
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{ttl: ttl, hosts: make(map[string]dnsEntry)}
+}
+
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	c.mu.RLock()
+	entry, ok := c.hosts[host]
+	c.mu.RUnlock()
+	if ok && time.Now().Before(entry.expire) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.hosts[host] = dnsEntry{addrs: addrs, expire: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return addrs, nil
+}
+
+func (c *dnsCache) forget(host string) {
+	c.mu.Lock()
+	delete(c.hosts, host)
+	c.mu.Unlock()
+}
+
+func (c *dnsCache) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		addrs, err := c.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			return nil, errors.Errorf("no address found for host `%s`", host)
+		}
+		for _, ip := range addrs {
+			var conn net.Conn
+			if conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip, port)); err == nil {
+				return conn, nil
+			}
+		}
+		// 缓存的地址都连不上, 下次重新解析
+		c.forget(host)
+		return nil, err
+	}
+}
@@ -0,0 +1,41 @@
+package httpClient
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfileVerifyTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	// 默认配置校验证书, 自签名证书应该失败
+	if _, _, err := GetJson(srv.URL, url.Values{}); err == nil {
+		t.Fatal("default profile should verify tls certificate")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, caPEM, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterProfile(Profile{Name: "test-ca", CAFile: caFile, DNSCacheTTL: 60e9}); err != nil {
+		t.Fatal(err)
+	}
+	body, code, err := GetJson(srv.URL, url.Values{}, WithProfile("test-ca"))
+	if err != nil || code != http.StatusOK || string(body) != "ok" {
+		t.Fatalf("GetJson() = %s, %d, %v", body, code, err)
+	}
+
+	if _, _, err = GetJson(srv.URL, url.Values{}, WithProfile("not-exist")); err == nil {
+		t.Fatal("unknown profile should return error")
+	}
+}
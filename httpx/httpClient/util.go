@@ -3,8 +3,10 @@ package httpClient
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
+	"github.com/chenxinqun/ginWarpPkg/httpx/breaker"
 	trace "github.com/chenxinqun/ginWarpPkg/httpx/trace"
+	"github.com/chenxinqun/ginWarpPkg/metrics"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -14,44 +16,145 @@ import (
 	"go.uber.org/zap"
 )
 
-var defaultClient = &http.Client{
-	Transport: &http.Transport{
-		DisableKeepAlives:  true,
-		DisableCompression: true,
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-		MaxIdleConns:        100,
-		MaxConnsPerHost:     100,
-		MaxIdleConnsPerHost: 100,
-	},
+// bodyFunc 生成请求体, 重试时会再次调用
+type bodyFunc func() (io.Reader, error)
+
+func bytesBody(payload []byte) bodyFunc {
+	return func() (io.Reader, error) {
+		return bytes.NewReader(payload), nil
+	}
 }
 
-func doHTTP(ctx context.Context, method, url string, payload []byte, opt *option) ([]byte, int, error) {
+func doHTTP(ctx context.Context, method, url string, payload []byte, opt *option) (body []byte, httpCode int, err error) {
+	body, httpCode, _, err = doRequest(ctx, method, url, bytesBody(payload), nil, opt)
+	return
+}
+
+// doRequest 发起请求并按重试策略重试. sink 不为 nil 时, 成功的响应体直接写入 sink, 返回写入的字节数.
+func doRequest(ctx context.Context, method, url string, newBody bodyFunc, sink io.Writer, opt *option) (body []byte, httpCode int, written int64, err error) {
+	if opt.retry == nil {
+		return doHTTPOnce(ctx, method, url, newBody, sink, opt)
+	}
+
+	policy := opt.retry.normalize()
+	for attempt := 1; ; attempt++ {
+		body, httpCode, written, err = doHTTPOnce(ctx, method, url, newBody, sink, opt)
+		// 已经写入 sink 的内容无法撤回, 不再重试
+		if err == nil || written > 0 || attempt >= policy.MaxAttempts || !policy.shouldRetry(method, httpCode, err) {
+			return
+		}
+
+		wait := policy.backoff(attempt)
+		if after, ok := retryAfter(err); ok {
+			wait = after
+			if wait > policy.MaxBackoff {
+				wait = policy.MaxBackoff
+			}
+		}
+		// 剩余时间不够等待, 不再重试
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+			return
+		}
+
+		if opt.logger != nil {
+			opt.logger.Warn("doHTTP retry",
+				zap.String("method", method),
+				zap.String("url", url),
+				zap.Int("attempt", attempt),
+				zap.Duration("wait", wait),
+				zap.Error(err),
+			)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// doHTTPOnce 发起一次请求, 每次请求都会在 dialog 中记录一条 trace.Response
+func doHTTPOnce(ctx context.Context, method, url string, newBody bodyFunc, sink io.Writer, opt *option) ([]byte, int, int64, error) {
 	ts := time.Now()
 
 	if mock := opt.mock; mock != nil {
+		body := mock()
+		traceBody := interface{}(string(body))
+		var written int64
+		if sink != nil {
+			n, err := sink.Write(body)
+			if err != nil {
+				return nil, http.StatusOK, int64(n), errors.Wrapf(err, "write mock body of [%s %s] err", method, url)
+			}
+			written = int64(n)
+			traceBody = binaryMeta("", written)
+			body = nil
+		}
 		if opt.dialog != nil {
 			opt.dialog.AppendResponse(&trace.Response{
 				HttpCode:    http.StatusOK,
 				HttpCodeMsg: http.StatusText(http.StatusOK),
-				Body:        string(mock()),
+				Body:        traceBody,
 				CostSeconds: time.Since(ts).Seconds(),
 			})
 		}
-		return mock(), http.StatusOK, nil
+		return body, http.StatusOK, written, nil
+	}
+
+	if opt.trace != nil {
+		ctx = trace.NewContext(ctx, opt.trace)
+	}
+
+	client, err := GetProfileClient(opt.profile)
+	if err != nil {
+		return nil, -1, 0, err
+	}
+	client = chainClient(client, opt.interceptors)
+
+	reqBody, err := newBody()
+	if err != nil {
+		return nil, -1, 0, errors.Wrapf(err, "new request body [%s %s] err", method, url)
+	}
+	// 请求体可能是 io.Pipe, 请求没有发出就返回时要关闭, 否则写入请求体的协程会一直阻塞
+	closeBody := func() {
+		if c, ok := reqBody.(io.Closer); ok {
+			_ = c.Close()
+		}
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(payload))
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
 	if err != nil {
-		return nil, -1, errors.Wrapf(err, "new request [%s %s] err", method, url)
+		closeBody()
+		return nil, -1, 0, errors.Wrapf(err, "new request [%s %s] err", method, url)
 	}
 
 	for key, value := range opt.header {
 		req.Header.Set(key, value[0])
 	}
 
-	resp, err := defaultClient.Do(req)
+	var brk *breaker.Breaker
+	if opt.breaker != nil {
+		brk = opt.breaker.Get(req.URL.Host)
+		if e := brk.Allow(); e != nil {
+			closeBody()
+			return breakerFallback(brk, e, method, url, sink, opt, ts)
+		}
+	}
+
+	inFlightDone := metrics.ClientInFlight(req.URL.Host, method)
+	resp, err := client.Do(req)
+	inFlightDone()
+	var statusCode int
+	if err == nil {
+		statusCode = resp.StatusCode
+	}
+	metrics.RecordClientMetrics(req.URL.Host, method, normalizePath(req.URL.Path), statusClass(statusCode), time.Since(ts).Seconds())
+	if brk != nil {
+		brk.Done(err == nil && resp.StatusCode < http.StatusInternalServerError, time.Since(ts))
+	}
 	if err != nil {
 		err = errors.Wrapf(err, "do request [%s %s] err", method, url)
 		if opt.dialog != nil {
@@ -68,10 +171,39 @@ func doHTTP(ctx context.Context, method, url string, payload []byte, opt *option
 		if resp != nil {
 			code = resp.StatusCode
 		}
-		return nil, code, err
+		return nil, code, 0, err
 	}
 	defer resp.Body.Close()
 
+	// 流式写入 sink, trace 中只记录元信息
+	if sink != nil && resp.StatusCode == http.StatusOK {
+		var src io.Reader = resp.Body
+		if opt.progress != nil {
+			src = newProgressReader(src, resp.ContentLength, opt.progress)
+		}
+		written, err := io.Copy(sink, src)
+		if err != nil {
+			err = errors.Wrapf(err, "write resp body from [%s %s] err", method, url)
+			if opt.logger != nil {
+				opt.logger.Warn("doHTTP got err", zap.Error(err))
+			}
+		}
+		if opt.dialog != nil {
+			traceBody := binaryMeta(resp.Header.Get("Content-Type"), written)
+			if err != nil {
+				traceBody["error"] = err.Error()
+			}
+			opt.dialog.AppendResponse(&trace.Response{
+				Header:      resp.Header,
+				HttpCode:    resp.StatusCode,
+				HttpCodeMsg: resp.Status,
+				Body:        traceBody,
+				CostSeconds: time.Since(ts).Seconds(),
+			})
+		}
+		return nil, resp.StatusCode, written, err
+	}
+
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		err = errors.Wrapf(err, "read resp body from [%s %s] err", method, url)
@@ -85,7 +217,7 @@ func doHTTP(ctx context.Context, method, url string, payload []byte, opt *option
 		if opt.logger != nil {
 			opt.logger.Warn("doHTTP got err", zap.Error(err))
 		}
-		return nil, resp.StatusCode, err
+		return nil, resp.StatusCode, 0, err
 	}
 
 	defer func() {
@@ -101,14 +233,65 @@ func doHTTP(ctx context.Context, method, url string, payload []byte, opt *option
 	}()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, resp.StatusCode, newReplyErr(
-			resp.StatusCode,
-			body,
-			errors.Errorf("do [%s %s] return business_code: %d message: %s", method, url, resp.StatusCode, string(body)),
-		)
+		return nil, resp.StatusCode, 0, &replyError{
+			statusCode: resp.StatusCode,
+			body:       body,
+			header:     resp.Header,
+			err:        errors.Errorf("do [%s %s] return business_code: %d message: %s", method, url, resp.StatusCode, string(body)),
+		}
 	}
 
-	return body, http.StatusOK, nil
+	return body, http.StatusOK, 0, nil
+}
+
+// breakerFallback 熔断器打开时, 使用降级内容作为响应, 没有降级处理则返回熔断错误
+func breakerFallback(brk *breaker.Breaker, openErr error, method, url string, sink io.Writer, opt *option, ts time.Time) ([]byte, int, int64, error) {
+	body, err := brk.Fallback(openErr)
+	if err != nil {
+		if opt.dialog != nil {
+			opt.dialog.AppendResponse(&trace.Response{
+				HttpCode:    http.StatusServiceUnavailable,
+				HttpCodeMsg: http.StatusText(http.StatusServiceUnavailable),
+				Body:        err.Error(),
+				CostSeconds: time.Since(ts).Seconds(),
+			})
+		}
+		if opt.logger != nil {
+			opt.logger.Warn("doHTTP breaker open", zap.String("method", method), zap.String("url", url), zap.Error(err))
+		}
+		return nil, http.StatusServiceUnavailable, 0, err
+	}
+
+	var (
+		written   int64
+		traceBody interface{} = string(body)
+	)
+	if sink != nil {
+		n, e := sink.Write(body)
+		written = int64(n)
+		if e != nil {
+			return nil, http.StatusOK, written, errors.Wrapf(e, "write fallback body of [%s %s] err", method, url)
+		}
+		traceBody = binaryMeta("", written)
+		body = nil
+	}
+	if opt.dialog != nil {
+		opt.dialog.AppendResponse(&trace.Response{
+			HttpCode:    http.StatusOK,
+			HttpCodeMsg: "fallback",
+			Body:        traceBody,
+			CostSeconds: time.Since(ts).Seconds(),
+		})
+	}
+	return body, http.StatusOK, written, nil
+}
+
+// binaryMeta 二进制内容在 trace 中只记录元信息
+func binaryMeta(contentType string, size int64) map[string]interface{} {
+	return map[string]interface{}{
+		"content_type": contentType,
+		"size":         size,
+	}
 }
 
 // addFormValuesIntoURL append url.Values into url string
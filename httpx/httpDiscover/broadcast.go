@@ -0,0 +1,121 @@
+package httpDiscover
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/datax/etcdx"
+	"github.com/chenxinqun/ginWarpPkg/errno"
+	"github.com/chenxinqun/ginWarpPkg/httpx/httpClient"
+	"github.com/chenxinqun/ginWarpPkg/httpx/mux"
+
+	"go.uber.org/multierr"
+)
+
+// DefaultBroadcastConcurrency 广播时默认同时请求的实例数
+const DefaultBroadcastConcurrency = 10
+
+// BroadcastResult 广播时单个实例的请求结果
+type BroadcastResult struct {
+	Service  etcdx.ServiceInfo
+	Body     []byte
+	HttpCode int
+	Err      error
+}
+
+// Broadcast 向服务的所有实例发送同一个请求, 用于清理缓存, 刷新配置等场景. 只请求注册协议为客户端协议的实例, 见 WithScheme.
+// 返回按 ServiceInfo.ID 区分的每个实例的结果, 有实例失败时 error 为所有失败原因的合集.
+// 请求参数的处理方式与 Call 相同, 不重试, 不使用灰度路由和健康状态过滤.
+//
+//	client.WithScheme("h2c").Broadcast(ctx, "cache", http.MethodPost, "/cache/clear", req)
+func (s *ServiceClient) Broadcast(ctx context.Context, serviceName, method, path string, body interface{}) (map[string]*BroadcastResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	requestFunc, requestData, err := encodeRequest(method, body)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := s.instances(serviceName, s.schemeOrDefault(""))
+	if len(instances) == 0 {
+		return nil, errno.Errorf("%s 服务找不到", serviceName)
+	}
+
+	handlers := append(s.requestOptions(ctx, mux.HeaderFromContext(ctx)), httpClient.WithTTL(s.broadcastTimeout))
+	c := &call{ctx: ctx, serviceName: serviceName, urlPath: path, attempt: 1, requestFunc: requestFunc, requestData: requestData, handlers: handlers}
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, s.broadcastConcurrency)
+		ret = make(map[string]*BroadcastResult, len(instances))
+	)
+	for _, service := range instances {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(service etcdx.ServiceInfo) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			r := &BroadcastResult{Service: service}
+			r.Body, r.HttpCode, r.Err = s.send(ctx, c, service, nil, false)
+			mu.Lock()
+			ret[service.ID] = r
+			mu.Unlock()
+		}(service)
+	}
+	wg.Wait()
+
+	for id, r := range ret {
+		if r.Err != nil {
+			err = multierr.Append(err, errno.Wrapf(r.Err, "broadcast to %s(%s) err", serviceName, id))
+		}
+	}
+	return ret, err
+}
+
+// WithScheme 返回请求指定协议实例的 ServiceClient, 协议为实例注册时的 ServiceInfo.Scheme, 不设置时为 http.
+// 其它状态(熔断, 健康检查等)共用.
+//
+//	client.WithScheme("h2c").GetJson(ctx, "search", "/v1/items", req, &resp)
+func (s *ServiceClient) WithScheme(scheme string) *ServiceClient {
+	c := *s
+	c.scheme = scheme
+	return &c
+}
+
+// schemeOrDefault scheme 不为空时直接返回, 否则返回客户端的协议, 都没有时为 http
+func (s *ServiceClient) schemeOrDefault(scheme string) string {
+	if scheme != "" {
+		return scheme
+	}
+	if s.scheme != "" {
+		return s.scheme
+	}
+	return "http"
+}
+
+// instances 服务的所有实例, 没有时重新发现一次
+func (s *ServiceClient) instances(serviceName, scheme string) []etcdx.ServiceInfo {
+	registers := s.registers(serviceName, scheme)
+	ret := make([]etcdx.ServiceInfo, 0, len(registers))
+	for _, sr := range registers {
+		ret = append(ret, sr.Val)
+	}
+	return ret
+}
+
+func broadcastDefaults(r *Resource) (concurrency int, timeout time.Duration) {
+	concurrency = r.BroadcastConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBroadcastConcurrency
+	}
+	timeout = time.Duration(r.BroadcastTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = time.Duration(r.Timeout) * time.Second
+	}
+	return
+}
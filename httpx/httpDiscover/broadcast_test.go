@@ -0,0 +1,40 @@
+package httpDiscover
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestBroadcast(t *testing.T) {
+	ok := newTestInstance(t, "cache", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0}`))
+	})
+	bad := newTestInstance(t, "cache", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	s, d := newTestClient(Resource{}, ok, bad)
+
+	ret, err := s.Broadcast(context.Background(), "cache", http.MethodPost, "/cache/clear", struct{}{})
+	if err == nil {
+		t.Fatal("want error from failed instance")
+	}
+	if len(ret) != 2 || ret[ok.ID].Err != nil || ret[bad.ID].HttpCode != http.StatusInternalServerError {
+		t.Fatalf("unexpected results: %+v", ret)
+	}
+
+	// 只请求对应协议的实例
+	other := ok
+	other.ID, other.Scheme = "other", "h2c"
+	d.Add(other)
+	ret, _ = s.WithScheme("h2c").Broadcast(context.Background(), "cache", http.MethodPost, "/cache/clear", struct{}{})
+	if len(ret) != 1 || ret["other"] == nil {
+		t.Fatalf("unexpected results for scheme h2c: %+v", ret)
+	}
+
+	d.Remove("cache", ok.ID)
+	d.Remove("cache", bad.ID)
+	if _, err = s.Broadcast(context.Background(), "cache", http.MethodPost, "/cache/clear", struct{}{}); err == nil {
+		t.Fatal("want error when no instance")
+	}
+}
@@ -0,0 +1,90 @@
+package httpDiscover
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/chenxinqun/ginWarpPkg/convert"
+	"github.com/chenxinqun/ginWarpPkg/errno"
+	"github.com/chenxinqun/ginWarpPkg/httpx/httpClient"
+)
+
+// Call 使用默认客户端调用服务, 见 CallWith
+func Call[Req any, Resp any](ctx context.Context, service, method, path string, req Req) (Resp, error) {
+	return CallWith[Req, Resp](Default(), ctx, service, method, path, req)
+}
+
+// CallWith 调用服务, 返回值中 Result.Data 的部分解析到 Resp 中.
+// GET, DELETE 的请求参数通过 convert.StructToQuery 拼接到 url 中, 其他请求方式作为 json body 发送.
+// ctx 可以是任意携带了 trace 和身份信息的 context, 如 mux.Context.RequestContext(), 或者通过 mux.WithRequestValues,
+// mux.NewIdentityContext 创建的 context, 不依赖 mux.Context, kafka 消费者和定时任务中也可以使用.
+// 对方返回的业务码不是成功码时, 返回保留了原业务码和 HTTP 状态码的 *errno.Errno.
+func CallWith[Req any, Resp any](s *ServiceClient, ctx context.Context, service, method, path string, req Req) (ret Resp, err error) {
+	if s == nil {
+		return ret, errno.NewError("httpDiscover client not initialized")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	requestFunc, requestData, err := encodeRequest(method, req)
+	if err != nil {
+		return
+	}
+
+	body, httpCode, err := s.retryRequest(ctx, service, path, "", method, requestFunc, requestData)
+	if err != nil {
+		if e, ok := httpClient.ToReplyErr(err); ok {
+			if bizErr := httpClient.ToBusinessErrno(e.StatusCode(), e.Body(), err); bizErr != nil {
+				return ret, bizErr
+			}
+		}
+		return ret, err
+	}
+	if len(body) == 0 {
+		return
+	}
+
+	resp := new(httpClient.Envelope)
+	if err = json.Unmarshal(body, resp); err != nil {
+		return ret, errno.Wrapf(err, "unmarshal response of [%s %s%s] err", method, service, path)
+	}
+	if !httpClient.IsSucceedCode(resp.Code) {
+		return ret, errno.NewErrno(httpCode, resp.Code, resp.Msg).
+			WithErr(errno.Errorf("call [%s %s%s] return business_code: %d message: %s", method, service, path, resp.Code, resp.Msg))
+	}
+	if len(resp.Data) == 0 || string(resp.Data) == "null" {
+		return
+	}
+	if err = json.Unmarshal(resp.Data, &ret); err != nil {
+		err = errno.Wrapf(err, "unmarshal response data of [%s %s%s] err", method, service, path)
+	}
+	return
+}
+
+// encodeRequest GET, DELETE 的请求参数通过 convert.StructToQuery 转换, 其他请求方式转换为 json
+func encodeRequest(method string, req interface{}) (requestFunc httpClient.RequestFunc, requestData interface{}, err error) {
+	switch method {
+	case http.MethodGet, http.MethodDelete:
+		if requestData, err = convert.StructToQuery(req); err != nil {
+			return
+		}
+		requestFunc = httpClient.GetJson
+		if method == http.MethodDelete {
+			requestFunc = httpClient.DeleteJson
+		}
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		if requestData, err = convert.StructToJSON(req); err != nil {
+			return
+		}
+		requestFunc = map[string]httpClient.RequestFunc{
+			http.MethodPost:  httpClient.PostJSON,
+			http.MethodPut:   httpClient.PutJSON,
+			http.MethodPatch: httpClient.PatchJSON,
+		}[method]
+	default:
+		err = errno.Errorf("unsupported method `%s`", method)
+	}
+	return
+}
@@ -0,0 +1,453 @@
+package httpDiscover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/datax/etcdx"
+	"github.com/chenxinqun/ginWarpPkg/errno"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+// Discoverer 服务发现接口, ServiceClient 只通过它获取服务实例, 负载均衡, 健康检查等在所有实现上表现一致
+type Discoverer interface {
+	// Instances 服务的所有实例, 返回的切片调用方可以随意修改
+	Instances(name, scheme string) []etcdx.ServiceRegister
+	// Refresh 重新发现一次服务, 拿不到实例时调用
+	Refresh() error
+}
+
+// discovererHolder 保存当前使用的服务发现, WithRetry 等派生出的客户端和后台健康检查共用同一个
+type discovererHolder struct {
+	mu sync.RWMutex
+	d  Discoverer
+}
+
+func (h *discovererHolder) load() Discoverer {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.d
+}
+
+func (h *discovererHolder) store(d Discoverer) {
+	h.mu.Lock()
+	h.d = d
+	h.mu.Unlock()
+}
+
+// SetDiscoverer 替换服务发现方式, 后台健康检查也会改为探测新的服务发现返回的实例
+func (s *ServiceClient) SetDiscoverer(d Discoverer) *ServiceClient {
+	s.discoverer.store(d)
+	return s
+}
+
+// registers 服务的所有实例, 没有时重新发现一次
+func (s *ServiceClient) registers(serviceName, scheme string) []etcdx.ServiceRegister {
+	d := s.discoverer.load()
+	if d == nil {
+		return nil
+	}
+	l := d.Instances(serviceName, scheme)
+	if len(l) == 0 {
+		_ = d.Refresh()
+		l = d.Instances(serviceName, scheme)
+	}
+	return l
+}
+
+// etcdDiscoverer 基于 etcd 的服务发现
+type etcdDiscoverer struct {
+	repo etcdx.Repo
+}
+
+// NewEtcdDiscoverer 基于 etcd 的服务发现, 不传 Resource.Discoverer 时的默认实现
+func NewEtcdDiscoverer(repo etcdx.Repo) Discoverer {
+	return &etcdDiscoverer{repo: repo}
+}
+
+func (d *etcdDiscoverer) Instances(name, scheme string) []etcdx.ServiceRegister {
+	return d.repo.GetRepo().GetServiceRegisters(name, scheme)
+}
+
+func (d *etcdDiscoverer) Refresh() error {
+	return d.repo.Discover(d.repo.GetRepo().Service.Val)
+}
+
+// listing 按服务名称和协议保存的实例列表, 供内存和静态文件实现共用
+type listing struct {
+	mu       sync.RWMutex
+	services etcdx.ServiceListing
+}
+
+func (l *listing) Instances(name, scheme string) []etcdx.ServiceRegister {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return append([]etcdx.ServiceRegister(nil), l.services[name][scheme]...)
+}
+
+func (l *listing) Refresh() error {
+	return nil
+}
+
+func (l *listing) set(services []etcdx.ServiceInfo) {
+	m := make(etcdx.ServiceListing)
+	for _, service := range services {
+		add(m, service)
+	}
+	l.mu.Lock()
+	l.services = m
+	l.mu.Unlock()
+}
+
+func add(m etcdx.ServiceListing, service etcdx.ServiceInfo) {
+	if service.Scheme == "" {
+		service.Scheme = "http"
+	}
+	if m[service.Name] == nil {
+		m[service.Name] = make(map[string][]etcdx.ServiceRegister)
+	}
+	m[service.Name][service.Scheme] = append(m[service.Name][service.Scheme], etcdx.ServiceRegister{Key: instanceKey(service), Val: service})
+}
+
+// MemoryDiscoverer 内存中的服务发现, 用于单元测试和本地调试, 不需要 etcd
+type MemoryDiscoverer struct {
+	listing
+}
+
+func NewMemoryDiscoverer(services ...etcdx.ServiceInfo) *MemoryDiscoverer {
+	d := new(MemoryDiscoverer)
+	d.set(services)
+	return d
+}
+
+// Set 替换所有实例
+func (d *MemoryDiscoverer) Set(services ...etcdx.ServiceInfo) {
+	d.set(services)
+}
+
+// Add 添加实例, Scheme 不填时为 http
+func (d *MemoryDiscoverer) Add(services ...etcdx.ServiceInfo) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.services == nil {
+		d.services = make(etcdx.ServiceListing)
+	}
+	for _, service := range services {
+		add(d.services, service)
+	}
+}
+
+// Remove 删除实例, id 为 ServiceInfo.ID, 没有 ID 时为 ServiceInfo.Url()
+func (d *MemoryDiscoverer) Remove(name, id string) {
+	key := instanceKey(etcdx.ServiceInfo{Name: name, ID: id})
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for scheme, l := range d.services[name] {
+		ret := make([]etcdx.ServiceRegister, 0, len(l))
+		for _, sr := range l {
+			if instanceKey(sr.Val) != key {
+				ret = append(ret, sr)
+			}
+		}
+		d.services[name][scheme] = ret
+	}
+}
+
+// StaticDiscoverer 从 YAML 或 JSON 文件读取服务实例, 文件内容为 etcdx.ServiceInfo 的列表, 字段名与 json tag 相同:
+//
+//   - Name: user
+//     Addr: 127.0.0.1
+//     Port: 8080
+//     HealthPath: /health
+//
+// 文件修改后自动重新加载, 加载失败时保留上一次的实例.
+type StaticDiscoverer struct {
+	listing
+	path    string
+	logger  *zap.Logger
+	modTime time.Time
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// NewStaticDiscoverer interval 为检查文件修改的间隔, 小于等于 0 时不检查
+func NewStaticDiscoverer(path string, interval time.Duration, logger *zap.Logger) (*StaticDiscoverer, error) {
+	d := &StaticDiscoverer{path: path, logger: logger, stop: make(chan struct{})}
+	if err := d.Refresh(); err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		go d.watch(interval)
+	}
+	return d, nil
+}
+
+// Refresh 重新读取文件
+func (d *StaticDiscoverer) Refresh() error {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return errno.Wrapf(err, "stat %s err", d.path)
+	}
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		return errno.Wrapf(err, "read %s err", d.path)
+	}
+	services, err := parseServices(d.path, data)
+	if err != nil {
+		return err
+	}
+	d.set(services)
+	d.mu.Lock()
+	d.modTime = info.ModTime()
+	d.mu.Unlock()
+	return nil
+}
+
+// Close 停止检查文件修改
+func (d *StaticDiscoverer) Close() {
+	d.once.Do(func() {
+		close(d.stop)
+	})
+}
+
+func (d *StaticDiscoverer) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			info, err := os.Stat(d.path)
+			if err != nil {
+				continue
+			}
+			d.mu.RLock()
+			changed := !info.ModTime().Equal(d.modTime)
+			d.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err = d.Refresh(); err != nil && d.logger != nil {
+				d.logger.Error("重新加载服务列表失败", zap.String("path", d.path), zap.Error(err))
+			}
+		}
+	}
+}
+
+// parseServices 按扩展名解析, .yaml 和 .yml 以外的都按 json 解析.
+// yaml 先转换为 json, 这样字段名与 etcd 中保存的 json 一致.
+func parseServices(path string, data []byte) ([]etcdx.ServiceInfo, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var v interface{}
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, errno.Wrapf(err, "parse %s err", path)
+		}
+		v = yamlToJSON(v)
+		// Meta 等字段的值是字符串, yaml 中 weight: 2 这样的写法需要转换
+		if list, ok := v.([]interface{}); ok {
+			for _, item := range list {
+				if m, ok := item.(map[string]interface{}); ok {
+					stringValues(m, "Meta")
+					stringValues(m, "HealthVerdict")
+				}
+			}
+		}
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil, errno.Wrapf(err, "parse %s err", path)
+		}
+	}
+	var services []etcdx.ServiceInfo
+	if err := json.Unmarshal(data, &services); err != nil {
+		return nil, errno.Wrapf(err, "parse %s err", path)
+	}
+	for i, service := range services {
+		if service.Name == "" {
+			return nil, errno.Errorf("parse %s err: 第 %d 个服务没有 Name", path, i+1)
+		}
+	}
+	return services, nil
+}
+
+// yamlToJSON yaml.v2 解析出的 map 的 key 是 interface{}, 需要转换后才能 json 序列化
+func yamlToJSON(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[fmt.Sprint(k)] = yamlToJSON(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range val {
+			val[i] = yamlToJSON(item)
+		}
+	}
+	return v
+}
+
+func stringValues(service map[string]interface{}, key string) {
+	m, ok := service[key].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for k, v := range m {
+		if v != nil {
+			m[k] = fmt.Sprint(v)
+		}
+	}
+}
+
+// DNS 服务发现的查询方式
+const (
+	// DNSModeSRV 查询 SRV 记录, 端口从记录中获取
+	DNSModeSRV = "srv"
+	// DNSModeA 查询 A/AAAA 记录, 如 Kubernetes headless service, 端口使用 DNSConfig.Port
+	DNSModeA = "a"
+
+	DefaultDNSTTL = 10 * time.Second
+)
+
+// DNSConfig DNS 服务发现配置
+type DNSConfig struct {
+	// Mode 查询方式, DNSModeSRV 或 DNSModeA, 默认为 DNSModeA
+	Mode string `toml:"mode" json:"mode"`
+	// HostPattern 服务名称到域名的模板, 如 "%s.default.svc.cluster.local", 不填时直接使用服务名称
+	HostPattern string `toml:"hostPattern" json:"hostPattern"`
+	// SRV 记录的 service 和 proto, 如 "http", "tcp", 都不填时直接查询域名
+	SrvService string `toml:"srvService" json:"srvService"`
+	SrvProto   string `toml:"srvProto" json:"srvProto"`
+	// Port A 记录模式时实例的端口
+	Port int `toml:"port" json:"port"`
+	// TTL 查询结果的缓存时间, 默认 10 秒
+	TTL time.Duration `toml:"ttl" json:"ttl"`
+	// Timeout 单次查询的超时时间, 默认 3 秒
+	Timeout time.Duration `toml:"timeout" json:"timeout"`
+}
+
+// DNSDiscoverer 基于 DNS 的服务发现, 适用于 Kubernetes headless service 和 Consul 等提供 SRV 记录的注册中心.
+// 查询失败时继续使用上一次的结果.
+type DNSDiscoverer struct {
+	cfg      DNSConfig
+	resolver *net.Resolver
+	logger   *zap.Logger
+	mu       sync.Mutex
+	cache    map[string]*dnsEntry
+}
+
+type dnsEntry struct {
+	services []etcdx.ServiceInfo
+	expire   time.Time
+}
+
+// NewDNSDiscoverer resolver 为 nil 时使用 net.DefaultResolver
+func NewDNSDiscoverer(cfg DNSConfig, resolver *net.Resolver, logger *zap.Logger) (*DNSDiscoverer, error) {
+	if cfg.Mode == "" {
+		cfg.Mode = DNSModeA
+	}
+	if cfg.Mode != DNSModeA && cfg.Mode != DNSModeSRV {
+		return nil, errno.Errorf("unsupported dns mode `%s`", cfg.Mode)
+	}
+	if cfg.Mode == DNSModeA && cfg.Port <= 0 {
+		return nil, errno.NewError("dns mode `a` requires port")
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultDNSTTL
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 3 * time.Second
+	}
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &DNSDiscoverer{cfg: cfg, resolver: resolver, logger: logger, cache: make(map[string]*dnsEntry)}, nil
+}
+
+func (d *DNSDiscoverer) Instances(name, scheme string) []etcdx.ServiceRegister {
+	if scheme == "" {
+		scheme = "http"
+	}
+	d.mu.Lock()
+	entry, ok := d.cache[name]
+	d.mu.Unlock()
+	if !ok || time.Now().After(entry.expire) {
+		services, err := d.lookup(name)
+		if err != nil {
+			if d.logger != nil {
+				d.logger.Error("dns 服务发现失败", zap.String("name", name), zap.Error(err))
+			}
+			if !ok {
+				return nil
+			}
+		} else {
+			entry = &dnsEntry{services: services, expire: time.Now().Add(d.cfg.TTL)}
+			d.mu.Lock()
+			d.cache[name] = entry
+			d.mu.Unlock()
+		}
+	}
+	ret := make([]etcdx.ServiceRegister, 0, len(entry.services))
+	for _, service := range entry.services {
+		service.Scheme = scheme
+		ret = append(ret, etcdx.ServiceRegister{Key: service.ID, Val: service})
+	}
+	return ret
+}
+
+// Refresh 清空缓存, 下次获取实例时重新查询
+func (d *DNSDiscoverer) Refresh() error {
+	d.mu.Lock()
+	d.cache = make(map[string]*dnsEntry)
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *DNSDiscoverer) lookup(name string) ([]etcdx.ServiceInfo, error) {
+	host := name
+	if d.cfg.HostPattern != "" {
+		host = fmt.Sprintf(d.cfg.HostPattern, name)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d.cfg.Timeout)
+	defer cancel()
+
+	ret := make([]etcdx.ServiceInfo, 0)
+	newService := func(addr string, port int) etcdx.ServiceInfo {
+		return etcdx.ServiceInfo{ID: net.JoinHostPort(addr, strconv.Itoa(port)), Name: name, Addr: addr, Port: port}
+	}
+	if d.cfg.Mode == DNSModeA {
+		addrs, err := d.resolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, errno.Wrapf(err, "lookup %s err", host)
+		}
+		for _, addr := range addrs {
+			ret = append(ret, newService(addr, d.cfg.Port))
+		}
+		return ret, nil
+	}
+
+	_, srvs, err := d.resolver.LookupSRV(ctx, d.cfg.SrvService, d.cfg.SrvProto, host)
+	if err != nil {
+		return nil, errno.Wrapf(err, "lookup srv %s err", host)
+	}
+	for _, srv := range srvs {
+		// SRV 的 target 是域名, 在 Kubernetes 中形如 pod.svc.ns.svc.cluster.local, ServiceInfo.Url 会把它当成 k8s 服务地址处理,
+		// 所以解析为 ip 后再使用
+		addrs, err := d.resolver.LookupHost(ctx, strings.TrimSuffix(srv.Target, "."))
+		if err != nil || len(addrs) == 0 {
+			continue
+		}
+		ret = append(ret, newService(addrs[0], int(srv.Port)))
+	}
+	return ret, nil
+}
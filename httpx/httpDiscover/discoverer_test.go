@@ -0,0 +1,103 @@
+package httpDiscover
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/httpx/breaker"
+)
+
+func TestServiceClientMemoryDiscoverer(t *testing.T) {
+	echo := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			data, _ := json.Marshal(map[string]interface{}{
+				"code": 0,
+				"data": map[string]string{"from": name, "method": r.Method, "path": r.URL.Path, "body": string(body)},
+			})
+			_, _ = w.Write(data)
+		}
+	}
+	type reply struct {
+		From   string `json:"from"`
+		Method string `json:"method"`
+		Path   string `json:"path"`
+		Body   string `json:"body"`
+	}
+	a := newTestInstance(t, "order", echo("a"))
+	b := newTestInstance(t, "order", echo("b"))
+	s, d := newTestClient(Resource{Retry: &RetryPolicy{MaxAttempts: 1}}, a)
+	ctx := context.Background()
+
+	got, err := CallWith[struct{}, reply](s, ctx, "order", http.MethodGet, "/orders/1", struct{}{})
+	if err != nil || got.From != "a" || got.Method != http.MethodGet || got.Path != "/orders/1" {
+		t.Fatalf("GET = %+v, %v", got, err)
+	}
+	got, err = CallWith[map[string]int, reply](s, ctx, "order", http.MethodPost, "/orders", map[string]int{"id": 2})
+	if err != nil || got.Method != http.MethodPost || got.Body != `{"id":2}` {
+		t.Fatalf("POST = %+v, %v", got, err)
+	}
+
+	// 删除所有实例后请求失败
+	d.Remove("order", a.ID)
+	if _, err = CallWith[struct{}, reply](s, ctx, "order", http.MethodGet, "/orders/1", struct{}{}); err == nil {
+		t.Fatal("want error without instances")
+	}
+
+	// 替换服务发现后请求新的实例, WithRetry 派生的客户端同样生效
+	s.SetDiscoverer(NewMemoryDiscoverer(b))
+	got, err = CallWith[struct{}, reply](s.WithRetry(RetryPolicy{MaxAttempts: 2}), ctx, "order", http.MethodGet, "/orders/1", struct{}{})
+	if err != nil || got.From != "b" {
+		t.Fatalf("GET after SetDiscoverer = %+v, %v", got, err)
+	}
+}
+
+func TestHealthFollowsDiscoverer(t *testing.T) {
+	var probes int32
+	service := newTestInstance(t, "stock", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			atomic.AddInt32(&probes, 1)
+		}
+		_, _ = w.Write([]byte(`{"code":0,"data":{}}`))
+	})
+	service.HealthPath = "/health"
+
+	// 创建时没有实例, 之后替换的服务发现也要被后台健康检查使用
+	s := CreateSpecialHttpClient(Resource{Discoverer: NewMemoryDiscoverer(), Health: HealthConfig{Interval: 10 * time.Millisecond}})
+	defer s.Close()
+	s.health.watch("stock", "http")
+	s.SetDiscoverer(NewMemoryDiscoverer(service))
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&probes) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&probes) == 0 {
+		t.Fatal("health checker did not probe instances of the new discoverer")
+	}
+}
+
+func TestBreakerPrunedWithInstance(t *testing.T) {
+	a := newTestInstance(t, "cart", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0,"data":{}}`))
+	})
+	s, d := newTestClient(Resource{Breaker: &breaker.Config{Name: "prune"}}, a)
+	if _, err := CallWith[struct{}, struct{}](s, context.Background(), "cart", http.MethodGet, "/items", struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.breakers.States()[instanceKey(a)]; !ok {
+		t.Fatal("breaker not created for instance")
+	}
+
+	// 实例下线后, 下一轮探测删除对应的熔断器
+	d.Remove("cart", a.ID)
+	s.health.probeAll(d)
+	if _, ok := s.breakers.States()[instanceKey(a)]; ok {
+		t.Error("breaker not removed after instance left discovery")
+	}
+}
@@ -0,0 +1,336 @@
+package httpDiscover
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/businessCodex"
+	"github.com/chenxinqun/ginWarpPkg/datax/etcdx"
+	"github.com/chenxinqun/ginWarpPkg/errno"
+	"github.com/chenxinqun/ginWarpPkg/httpx/breaker"
+	"github.com/chenxinqun/ginWarpPkg/httpx/httpClient"
+	"github.com/chenxinqun/ginWarpPkg/httpx/mux"
+	"github.com/chenxinqun/ginWarpPkg/httpx/trace"
+
+	"go.uber.org/zap"
+)
+
+// GatewayRoute 网关路由, 把路径前缀映射到服务
+type GatewayRoute struct {
+	// Prefix 匹配的路径前缀, 如 /api/user, 多个前缀都匹配时使用最长的
+	Prefix string `toml:"prefix" json:"prefix"`
+	// Service 转发到的服务名称
+	Service string `toml:"service" json:"service"`
+	// Scheme 服务的协议, 默认 http
+	Scheme string `toml:"scheme" json:"scheme"`
+	// StripPrefix 转发时去掉 Prefix, 如 /api/user/v1/info 转发为 /v1/info
+	StripPrefix bool `toml:"stripPrefix" json:"stripPrefix"`
+	// Rewrite 转发时加在路径前面的前缀, 与 StripPrefix 一起使用可以替换前缀
+	Rewrite string `toml:"rewrite" json:"rewrite"`
+	// Profile 转发使用的 httpClient 客户端配置, 如 TLS 证书, 连接池, 不填时使用默认配置
+	Profile string `toml:"profile" json:"profile"`
+}
+
+func (r GatewayRoute) validate() error {
+	if !strings.HasPrefix(r.Prefix, "/") {
+		return errno.Errorf("gateway route prefix `%s` must start with /", r.Prefix)
+	}
+	if r.Service == "" {
+		return errno.Errorf("gateway route `%s` service is empty", r.Prefix)
+	}
+	return nil
+}
+
+func (r GatewayRoute) match(path string) bool {
+	prefix := strings.TrimRight(r.Prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/") || prefix == ""
+}
+
+// rewrite 转发到下游的路径
+func (r GatewayRoute) rewrite(path string) string {
+	if r.StripPrefix {
+		path = strings.TrimPrefix(path, strings.TrimRight(r.Prefix, "/"))
+	}
+	path = strings.TrimRight(r.Rewrite, "/") + path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// Gateway 反向代理, 按路径前缀把请求转发到通过服务发现找到的实例上. 使用 ServiceClient 的负载均衡, 健康状态, 熔断和灰度路由,
+// 支持流式响应和 websocket. 请求体是流式转发的, 所以不重试. Mount 注册的路由不会被 mux 预先读取请求体, 链路中也不记录请求体.
+// 转发使用 GatewayRoute.Profile 对应的 httpClient 客户端, 并记录与 httpClient 相同的对外请求指标.
+// 鉴权, 限流, CORS 等中间件与普通接口一样, 挂在注册网关的路由组上即可:
+//
+//	gw, _ := httpDiscover.NewGateway(client, httpDiscover.GatewayRoute{Prefix: "/api/user", Service: "user", StripPrefix: true})
+//	gw.Mount(m.Group("/api", auth), "")
+type Gateway struct {
+	client *ServiceClient
+	logger *zap.Logger
+	mu     sync.RWMutex
+	// 按前缀长度从长到短排列
+	routes []GatewayRoute
+	proxy  *httputil.ReverseProxy
+}
+
+type gatewayTarget struct {
+	route    GatewayRoute
+	service  etcdx.ServiceInfo
+	routeTag string
+	c        mux.Context
+}
+
+type gatewayTargetKey struct{}
+
+func NewGateway(client *ServiceClient, routes ...GatewayRoute) (*Gateway, error) {
+	if client == nil {
+		return nil, errno.NewError("httpDiscover client not initialized")
+	}
+	g := &Gateway{client: client, logger: client.logger}
+	if err := g.SetRoutes(routes); err != nil {
+		return nil, err
+	}
+	g.proxy = &httputil.ReverseProxy{
+		Director: g.director,
+		// 立即刷新, 支持 SSE 等流式响应
+		FlushInterval: -1,
+		ErrorHandler:  g.errorHandler,
+		Transport:     httpClient.RoundTripperFunc(g.roundTrip),
+	}
+	return g, nil
+}
+
+// SetRoutes 替换路由表, 路由不合法时保留原路由表
+func (g *Gateway) SetRoutes(routes []GatewayRoute) error {
+	sorted := make([]GatewayRoute, 0, len(routes))
+	for _, route := range routes {
+		if err := route.validate(); err != nil {
+			return err
+		}
+		if route.Scheme == "" {
+			route.Scheme = "http"
+		}
+		sorted = append(sorted, route)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].Prefix) > len(sorted[j].Prefix)
+	})
+	g.mu.Lock()
+	g.routes = sorted
+	g.mu.Unlock()
+	return nil
+}
+
+// Routes 当前的路由表
+func (g *Gateway) Routes() []GatewayRoute {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return append([]GatewayRoute(nil), g.routes...)
+}
+
+func (g *Gateway) load(raw []byte) error {
+	routes := make([]GatewayRoute, 0)
+	if err := json.Unmarshal(raw, &routes); err != nil {
+		return err
+	}
+	return g.SetRoutes(routes)
+}
+
+// Watch 从配置中心读取路由表并监听变更, key 为 etcdx.ConfigInfo.Prefix 下的相对路径, 值为 GatewayRoute 的 json 数组.
+// 更新的路由不合法时记录日志并保留原路由, 配置删除时清空路由表. 返回停止监听的函数.
+func (g *Gateway) Watch(repo etcdx.Repo, key string) (stop func(), err error) {
+	return etcdx.WatchKey(repo, key, func(value []byte) error {
+		if value == nil {
+			return g.SetRoutes(nil)
+		}
+		return g.load(value)
+	})
+}
+
+// Mount 把网关注册到路由组的 relativePath 下, 匹配所有请求方式和子路径. handlers 在转发之前执行, 如鉴权, 限流等.
+// 注册的路由会加入 mux.WithoutBodyCapture, 请求体不会被预先读取到内存中.
+func (g *Gateway) Mount(r mux.RouterGroup, relativePath string, handlers ...mux.HandlerFunc) {
+	routePath := strings.TrimRight(relativePath, "/") + "/*gatewayPath"
+	mux.WithoutBodyCapture(path.Join(r.BasePath(), routePath))
+	r.Any(routePath, append(handlers, g.Handler())...)
+}
+
+func (g *Gateway) match(path string) (GatewayRoute, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	for _, route := range g.routes {
+		if route.match(path) {
+			return route, true
+		}
+	}
+	return GatewayRoute{}, false
+}
+
+// Handler 转发请求的 HandlerFunc
+func (g *Gateway) Handler() mux.HandlerFunc {
+	return func(c mux.Context) {
+		req := c.Request()
+		route, ok := g.match(req.URL.Path)
+		if !ok {
+			c.AbortWithError(errno.New404Errno(businessCodex.GetServerErrorCode(), errno.Errorf("gateway route not found: %s", req.URL.Path)))
+			return
+		}
+
+		ctx := mux.WithRequestValues(req.Context(), c)
+		s := g.client
+		balancer := s.balancer
+		if s.hashKey != nil {
+			balancer = []etcdx.BalancerFunc{etcdx.ConsistentHashPolicy(s.hashKey(ctx))}
+		}
+		var serviceArray []etcdx.ServiceInfo
+		if l := s.registers(route.Service, route.Scheme); len(l) > 0 {
+			serviceArray = etcdx.ServiceArray(l, balancer...)
+		}
+		identity := mux.IdentityOf(c)
+		routeTag, serviceArray := s.route(route.Service, RouteRequest{UserID: identity.UserID, TenantID: identity.TenantID, Header: req.Header}, serviceArray)
+		s.health.watch(route.Service, route.Scheme)
+		serviceArray = s.filterAvailable(serviceArray)
+		if len(serviceArray) == 0 {
+			c.AbortWithError(errno.New503Errno(businessCodex.GetServiceUnavailableCode(), errno.Errorf("%s 服务找不到", route.Service)))
+			return
+		}
+
+		idx := 0
+		var (
+			rejected *breaker.Breaker
+			err      error
+		)
+		service, brk, ok := s.pick(serviceArray, &idx, &rejected, &err)
+		if !ok {
+			c.AbortWithError(errno.New503Errno(businessCodex.GetServiceUnavailableCode(), errno.Wrapf(err, "%s 服务已熔断", route.Service)))
+			return
+		}
+
+		target := &gatewayTarget{route: route, service: service, routeTag: routeTag, c: c}
+		w := &statusWriter{ResponseWriter: c.ResponseWriter()}
+		ts := time.Now()
+		done := s.inFlight.Start(service)
+		g.proxy.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), gatewayTargetKey{}, target)))
+		done()
+
+		if req.Context().Err() == nil {
+			s.health.report(service, w.status, w.err)
+			if brk != nil {
+				brk.Done(w.err == nil && w.status < http.StatusInternalServerError, time.Since(ts))
+			}
+		} else if brk != nil {
+			brk.Done(true, 0)
+		}
+		g.logger.Info("网关转发", zap.String("service name", route.Service), zap.String("url", service.Url()+route.rewrite(req.URL.Path)),
+			zap.Int("status", w.status), zap.Error(w.err))
+	}
+}
+
+// director 改写转发到下游的请求, 并注入链路和身份信息. 身份信息以鉴权中间件的结果为准, 覆盖客户端传入的同名请求头
+func (g *Gateway) director(req *http.Request) {
+	target, _ := req.Context().Value(gatewayTargetKey{}).(*gatewayTarget)
+	if target == nil {
+		return
+	}
+	service := target.service
+	req.URL.Scheme = service.Scheme
+	if req.URL.Scheme == "" || req.URL.Scheme == "grpc" {
+		req.URL.Scheme = "http"
+	}
+	req.URL.Host = strings.TrimPrefix(strings.TrimPrefix(service.Url(), "http://"), "https://")
+	req.URL.Path = target.route.rewrite(req.URL.Path)
+	req.URL.RawPath = ""
+	req.Host = req.URL.Host
+
+	if x := target.c.Trace(); x != nil {
+		req.Header.Set(trace.Header, x.ID())
+		req.Header.Set(trace.SpanHeader, trace.NewSpanID())
+	}
+	identity := mux.IdentityOf(target.c)
+	req.Header.Set(mux.UserID, fmt.Sprintf("%d", identity.UserID))
+	req.Header.Set(mux.UserName, identity.UserName)
+	req.Header.Set(mux.RoleType, fmt.Sprintf("%d", identity.RoleType))
+	req.Header.Set(mux.TenantID, fmt.Sprintf("%d", identity.TenantID))
+	req.Header.Set(mux.IsAdmin, fmt.Sprintf("%v", identity.IsAdmin))
+	if target.routeTag != "" {
+		req.Header.Set(RouteTagHeader, target.routeTag)
+	}
+	req.Header.Set("X-Forwarded-Host", target.c.Host())
+}
+
+// roundTrip 使用路由配置的 httpClient 客户端转发, 每次请求时获取, 重新注册的客户端配置立即生效
+func (g *Gateway) roundTrip(req *http.Request) (*http.Response, error) {
+	var profile string
+	if target, _ := req.Context().Value(gatewayTargetKey{}).(*gatewayTarget); target != nil {
+		profile = target.route.Profile
+	}
+	client, err := httpClient.GetProfileClient(profile)
+	if err != nil {
+		return nil, err
+	}
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return httpClient.MetricsInterceptor()(next).RoundTrip(req)
+}
+
+func (g *Gateway) errorHandler(w http.ResponseWriter, req *http.Request, err error) {
+	if sw, ok := w.(*statusWriter); ok {
+		sw.err = err
+	}
+	status := http.StatusBadGateway
+	if req.Context().Err() != nil {
+		// 客户端已经断开
+		status = 499
+	}
+	w.WriteHeader(status)
+}
+
+// statusWriter 记录下游返回的状态码, websocket 需要的 Hijack 和流式响应需要的 Flush 都透传给 gin 的 ResponseWriter
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	err    error
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		if w.status == 0 {
+			w.status = http.StatusSwitchingProtocols
+		}
+		return h.Hijack()
+	}
+	return nil, nil, errno.NewError("response writer does not support hijack")
+}
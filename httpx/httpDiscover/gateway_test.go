@@ -0,0 +1,92 @@
+package httpDiscover
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/httpx/mux"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestGatewayRouteRewrite(t *testing.T) {
+	cases := []struct {
+		route GatewayRoute
+		path  string
+		want  string
+	}{
+		{GatewayRoute{Prefix: "/api/user"}, "/api/user/v1/info", "/api/user/v1/info"},
+		{GatewayRoute{Prefix: "/api/user", StripPrefix: true}, "/api/user/v1/info", "/v1/info"},
+		{GatewayRoute{Prefix: "/api/user/", StripPrefix: true}, "/api/user/v1/info", "/v1/info"},
+		{GatewayRoute{Prefix: "/api/user", StripPrefix: true}, "/api/user", "/"},
+		{GatewayRoute{Prefix: "/api/user", StripPrefix: true, Rewrite: "/internal/"}, "/api/user/v1/info", "/internal/v1/info"},
+		{GatewayRoute{Prefix: "/api/user", StripPrefix: true, Rewrite: "internal"}, "/api/user/v1", "/internal/v1"},
+		{GatewayRoute{Prefix: "/api/user", Rewrite: "/v2"}, "/api/user/info", "/v2/api/user/info"},
+		{GatewayRoute{Prefix: "/", StripPrefix: true}, "/info", "/info"},
+	}
+	for _, c := range cases {
+		if got := c.route.rewrite(c.path); got != c.want {
+			t.Errorf("%+v rewrite(%s) = %s, want %s", c.route, c.path, got, c.want)
+		}
+	}
+}
+
+func TestGatewayStreamRequestBody(t *testing.T) {
+	received := make(chan string, 1)
+	service := newTestInstance(t, "upload", func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 5)
+		_, _ = io.ReadFull(r.Body, buf)
+		received <- r.URL.Path + " " + string(buf)
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	s, _ := newTestClient(Resource{}, service)
+	gw, err := NewGateway(s, GatewayRoute{Prefix: "/api/upload", Service: "upload", StripPrefix: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := gin.New()
+	engine.Use(mux.InitContext(mux.Resource{Logger: zap.NewNop()}, mux.Option{}))
+	m := &mux.Mux{Engine: engine}
+	gw.Mount(m.Group("/api"), "")
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	// 请求体没有发送完, 下游就应该收到前面的部分
+	pr, pw := io.Pipe()
+	var got string
+	go func() {
+		_, _ = pw.Write([]byte("part1"))
+		select {
+		case got = <-received:
+		case <-time.After(time.Second):
+			_ = pw.CloseWithError(io.ErrUnexpectedEOF)
+			return
+		}
+		_, _ = pw.Write([]byte("part2"))
+		_ = pw.Close()
+	}()
+	resp, err := http.Post(srv.URL+"/api/upload/files", "application/octet-stream", pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || got != "/files part1" {
+		t.Fatalf("status = %d, received = %s, request body not streamed", resp.StatusCode, got)
+	}
+
+	// 没有注册的 profile 转发失败
+	_ = gw.SetRoutes([]GatewayRoute{{Prefix: "/api/upload", Service: "upload", Profile: "not-registered"}})
+	resp, err = http.Get(srv.URL + "/api/upload/files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status with unknown profile = %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,375 @@
+package httpDiscover
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	httpURL "net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/businessCodex"
+	"github.com/chenxinqun/ginWarpPkg/datax/etcdx"
+	"github.com/chenxinqun/ginWarpPkg/errno"
+	"github.com/chenxinqun/ginWarpPkg/httpx/httpClient"
+	"github.com/chenxinqun/ginWarpPkg/httpx/mux"
+	"github.com/chenxinqun/ginWarpPkg/metrics"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultHealthInterval          = 10 * time.Second
+	DefaultHealthTimeout           = 2 * time.Second
+	DefaultHealthConsecutiveErrors = 5
+	DefaultBaseEjection            = 30 * time.Second
+	DefaultMaxEjection             = 5 * time.Minute
+)
+
+// HealthConfig 服务实例健康检查配置, 数值类的字段不填时使用默认值
+type HealthConfig struct {
+	// Interval 后台主动探测的间隔, 小于 0 时关闭主动探测
+	Interval time.Duration `toml:"interval" json:"interval"`
+	// Timeout 单次探测的超时时间
+	Timeout time.Duration `toml:"timeout" json:"timeout"`
+	// ConsecutiveErrors 实际请求连续多少次 5xx 或者超时后摘除实例
+	ConsecutiveErrors int `toml:"consecutiveErrors" json:"consecutiveErrors"`
+	// BaseEjection 第一次摘除的时长, 之后每次摘除时长翻倍, 最长为 MaxEjection
+	BaseEjection time.Duration `toml:"baseEjection" json:"baseEjection"`
+	MaxEjection  time.Duration `toml:"maxEjection" json:"maxEjection"`
+}
+
+func (c *HealthConfig) setDefaults() {
+	if c.Interval == 0 {
+		c.Interval = DefaultHealthInterval
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultHealthTimeout
+	}
+	if c.ConsecutiveErrors <= 0 {
+		c.ConsecutiveErrors = DefaultHealthConsecutiveErrors
+	}
+	if c.BaseEjection <= 0 {
+		c.BaseEjection = DefaultBaseEjection
+	}
+	if c.MaxEjection < c.BaseEjection {
+		c.MaxEjection = DefaultMaxEjection
+	}
+}
+
+// InstanceHealth 服务实例的健康状态
+type InstanceHealth struct {
+	Service string `json:"service"`
+	ID      string `json:"id"`
+	Url     string `json:"url"`
+	// Healthy 最近一次主动探测的结果
+	Healthy bool `json:"healthy"`
+	// Ejected 是否因为连续失败被摘除, 到 EjectedUntil 后自动恢复
+	Ejected           bool      `json:"ejected"`
+	EjectedUntil      time.Time `json:"ejectedUntil,omitempty"`
+	Ejections         int       `json:"ejections"`
+	ConsecutiveErrors int       `json:"consecutiveErrors"`
+	LastProbe         time.Time `json:"lastProbe,omitempty"`
+	LastError         string    `json:"lastError,omitempty"`
+}
+
+func (h *InstanceHealth) metricValue() int {
+	switch {
+	case h.Ejected:
+		return -1
+	case h.Healthy:
+		return 1
+	}
+	return 0
+}
+
+type healthChecker struct {
+	cfg    HealthConfig
+	logger *zap.Logger
+	probe  func(service etcdx.ServiceInfo) error
+
+	mu        sync.Mutex
+	instances map[string]*InstanceHealth
+	// 调用过的服务名称和协议, 只探测这些服务的实例
+	services map[string]string
+	// onRemove 实例下线后调用, 用于释放按实例保存的其他状态
+	onRemove func(key string)
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newHealthChecker(cfg HealthConfig, logger *zap.Logger, probe func(service etcdx.ServiceInfo) error) *healthChecker {
+	cfg.setDefaults()
+	return &healthChecker{
+		cfg:       cfg,
+		logger:    logger,
+		probe:     probe,
+		instances: make(map[string]*InstanceHealth),
+		services:  make(map[string]string),
+		stop:      make(chan struct{}),
+	}
+}
+
+// get 获取实例状态, 不存在则创建, 调用方需要持有锁
+func (h *healthChecker) get(service etcdx.ServiceInfo) *InstanceHealth {
+	key := instanceKey(service)
+	ih, ok := h.instances[key]
+	if !ok {
+		ih = &InstanceHealth{Service: service.Name, ID: service.ID, Url: service.Url(), Healthy: true}
+		h.instances[key] = ih
+	}
+	return ih
+}
+
+// watch 记录调用过的服务, 后台探测这些服务的实例
+func (h *healthChecker) watch(name, scheme string) {
+	h.mu.Lock()
+	h.services[name] = scheme
+	h.mu.Unlock()
+}
+
+// available 实例是否可用, 没有记录的实例视为可用
+func (h *healthChecker) available(service etcdx.ServiceInfo) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ih, ok := h.instances[instanceKey(service)]
+	if !ok {
+		return true
+	}
+	if ih.Ejected && !time.Now().Before(ih.EjectedUntil) {
+		// 摘除时间到了, 自动恢复
+		ih.Ejected = false
+		ih.ConsecutiveErrors = 0
+		metrics.RecordInstanceHealth(ih.Service, ih.Url, ih.metricValue())
+		h.logger.Info("服务实例恢复", zap.String("name", ih.Service), zap.String("url", ih.Url))
+	}
+	return ih.Healthy && !ih.Ejected
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// report 被动检测, 根据实际请求的结果统计连续失败次数, 达到阈值后摘除实例
+func (h *healthChecker) report(service etcdx.ServiceInfo, httpCode int, err error) {
+	failed := httpCode >= http.StatusInternalServerError || (httpCode == 0 && err != nil) || isTimeout(err)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ih := h.get(service)
+	if !failed {
+		ih.ConsecutiveErrors = 0
+		// 恢复后稳定运行了足够长的时间, 重新计算摘除时长
+		if ih.Ejections > 0 && !ih.Ejected && time.Since(ih.EjectedUntil) > h.cfg.MaxEjection {
+			ih.Ejections = 0
+		}
+		return
+	}
+	ih.ConsecutiveErrors++
+	if err != nil {
+		ih.LastError = err.Error()
+	} else {
+		ih.LastError = fmt.Sprintf("http status %d", httpCode)
+	}
+	if ih.Ejected || ih.ConsecutiveErrors < h.cfg.ConsecutiveErrors {
+		return
+	}
+
+	d := h.cfg.BaseEjection << uint(ih.Ejections)
+	if d > h.cfg.MaxEjection || d <= 0 {
+		d = h.cfg.MaxEjection
+	}
+	ih.Ejections++
+	ih.Ejected = true
+	ih.EjectedUntil = time.Now().Add(d)
+	metrics.RecordInstanceEjection(ih.Service, ih.Url)
+	metrics.RecordInstanceHealth(ih.Service, ih.Url, ih.metricValue())
+	h.logger.Warn("服务实例连续请求失败, 暂时摘除",
+		zap.String("name", ih.Service),
+		zap.String("url", ih.Url),
+		zap.Int("consecutiveErrors", ih.ConsecutiveErrors),
+		zap.Duration("ejection", d),
+		zap.String("lastError", ih.LastError),
+	)
+}
+
+// run 后台定时探测调用过的服务的所有实例, 每次探测前通过 discoverer 取当前的服务发现
+func (h *healthChecker) run(discoverer func() Discoverer) {
+	if h.cfg.Interval < 0 {
+		return
+	}
+	ticker := time.NewTicker(h.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			if d := discoverer(); d != nil {
+				h.probeAll(d)
+			}
+		}
+	}
+}
+
+func (h *healthChecker) probeAll(d Discoverer) {
+	h.mu.Lock()
+	services := make(map[string]string, len(h.services))
+	for name, scheme := range h.services {
+		services[name] = scheme
+	}
+	h.mu.Unlock()
+
+	targets := make([]etcdx.ServiceInfo, 0)
+	alive := make(map[string]bool)
+	for name, scheme := range services {
+		for _, sr := range d.Instances(name, scheme) {
+			targets = append(targets, sr.Val)
+			alive[instanceKey(sr.Val)] = true
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, service := range targets {
+		if service.HealthPath == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(service etcdx.ServiceInfo) {
+			defer wg.Done()
+			err := h.probe(service)
+
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			ih := h.get(service)
+			ih.LastProbe = time.Now()
+			ih.Healthy = err == nil
+			if err != nil {
+				ih.LastError = err.Error()
+			}
+			metrics.RecordInstanceHealth(ih.Service, ih.Url, ih.metricValue())
+		}(service)
+	}
+	wg.Wait()
+
+	// 已经下线的实例不再保留状态
+	removed := make([]string, 0)
+	h.mu.Lock()
+	for key, ih := range h.instances {
+		if _, ok := services[ih.Service]; ok && !alive[key] {
+			delete(h.instances, key)
+			metrics.DeleteInstanceHealth(ih.Service, ih.Url)
+			removed = append(removed, key)
+		}
+	}
+	h.mu.Unlock()
+	if h.onRemove != nil {
+		for _, key := range removed {
+			h.onRemove(key)
+		}
+	}
+}
+
+func (h *healthChecker) close() {
+	h.stopOnce.Do(func() {
+		close(h.stop)
+	})
+}
+
+func (h *healthChecker) states() []InstanceHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ret := make([]InstanceHealth, 0, len(h.instances))
+	for _, ih := range h.instances {
+		ret = append(ret, *ih)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Service != ret[j].Service {
+			return ret[i].Service < ret[j].Service
+		}
+		return ret[i].Url < ret[j].Url
+	})
+	return ret
+}
+
+// filterAvailable 过滤掉不健康和被摘除的实例, 全部不可用时返回原列表, 避免所有请求都直接失败
+func (s *ServiceClient) filterAvailable(serviceArray []etcdx.ServiceInfo) []etcdx.ServiceInfo {
+	ret := make([]etcdx.ServiceInfo, 0, len(serviceArray))
+	for _, service := range serviceArray {
+		if s.health.available(service) {
+			ret = append(ret, service)
+		}
+	}
+	if len(ret) == 0 && len(serviceArray) > 0 {
+		s.logger.Warn("服务的所有实例都不健康, 忽略健康状态", zap.String("name", serviceArray[0].Name))
+		return serviceArray
+	}
+	return ret
+}
+
+// HealthStates 服务实例的健康状态
+func (s *ServiceClient) HealthStates() []InstanceHealth {
+	return s.health.states()
+}
+
+// HealthHandler 以接口的形式返回服务实例的健康状态
+func (s *ServiceClient) HealthHandler() mux.HandlerFunc {
+	return func(c mux.Context) {
+		c.Payload(s.HealthStates())
+	}
+}
+
+// Close 停止后台健康探测和灰度路由规则的监听
+func (s *ServiceClient) Close() {
+	s.health.close()
+	if s.stopRouter != nil {
+		s.stopRouter()
+	}
+}
+
+// checkHealth 请求服务实例的健康检查接口, 根据 ServiceInfo.HealthVerdict 判断是否健康
+func (s *ServiceClient) checkHealth(service etcdx.ServiceInfo) error {
+	healthUrl := fmt.Sprintf("%s%s", service.Url(), service.HealthPath)
+	healthResp, httpCode, e := httpClient.GetJson(healthUrl, httpURL.Values{}, httpClient.WithTTL(s.health.cfg.Timeout))
+	if httpCode != http.StatusOK || e != nil {
+		s.logger.Error("健康检查请求", zap.Error(e),
+			zap.String("name", service.Name),
+			zap.String("url", healthUrl),
+			zap.Int("status", httpCode))
+		if e == nil {
+			e = errno.Errorf("health check status %d", httpCode)
+		}
+		return e
+	}
+	respData := &businessCodex.Response{}
+	e = json.Unmarshal(healthResp, &respData)
+	if e != nil {
+		s.logger.Error("健康检查返回值解析错误", zap.Error(e),
+			zap.String("name", service.Name),
+			zap.String("url", healthUrl),
+			zap.Int("status", httpCode),
+			zap.ByteString("response", healthResp),
+		)
+		return e
+	}
+	if len(service.HealthVerdict) == 0 {
+		return nil
+	}
+	healthData, _ := respData.Data.(map[string]interface{})
+	for k, v := range service.HealthVerdict {
+		if check, ok := healthData[k].(string); ok && check == v {
+			return nil
+		}
+	}
+	s.logger.Error("健康检查返回状态为不健康",
+		zap.String("name", service.Name),
+		zap.String("url", healthUrl),
+		zap.Int("status", httpCode),
+		zap.ByteString("response", healthResp),
+	)
+	return errno.Errorf("health check verdict mismatch: %s", healthResp)
+}
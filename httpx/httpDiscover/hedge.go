@@ -0,0 +1,190 @@
+package httpDiscover
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/datax/etcdx"
+	"github.com/chenxinqun/ginWarpPkg/httpx/breaker"
+)
+
+const (
+	// HedgeHeader 对冲请求会带上这个请求头, 方便下游区分
+	HedgeHeader = "X-Hedged-Request"
+
+	DefaultHedgeDelay    = 100 * time.Millisecond
+	DefaultMaxHedges     = 1
+	DefaultHedgeRatio    = 0.1
+	DefaultHedgeMinCount = 20
+
+	latencyWindow = 200
+)
+
+// HedgePolicy 对冲请求策略. 第一个请求超过 Delay 没有返回时, 向下一个实例再发一次相同的请求,
+// 取最先成功的响应, 并取消其它请求.
+type HedgePolicy struct {
+	// Delay 多久没有返回时发对冲请求, 不填时使用该服务最近请求耗时的 p95, 样本不足时使用 DefaultHedgeDelay
+	Delay time.Duration `toml:"delay" json:"delay"`
+	// MaxHedges 最多额外发送的请求数
+	MaxHedges int `toml:"maxHedges" json:"maxHedges"`
+	// MaxRatio 对冲请求数最多为总请求数的这个比例, 限制额外的负载
+	MaxRatio float64 `toml:"maxRatio" json:"maxRatio"`
+	// Methods 允许对冲的请求方式, 默认只有 GET
+	Methods []string `toml:"methods" json:"methods"`
+}
+
+func (p HedgePolicy) normalize() HedgePolicy {
+	if p.MaxHedges <= 0 {
+		p.MaxHedges = DefaultMaxHedges
+	}
+	if p.MaxRatio <= 0 {
+		p.MaxRatio = DefaultHedgeRatio
+	}
+	if len(p.Methods) == 0 {
+		p.Methods = []string{http.MethodGet}
+	}
+	return p
+}
+
+func (p *HedgePolicy) allow(method string) bool {
+	for _, m := range p.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// WithHedge 返回开启对冲请求的 ServiceClient, 用于单次调用, 其它状态(熔断, 健康检查等)共用.
+//
+//	client.WithHedge(httpDiscover.HedgePolicy{}).GetJson(ctx, "search", "/v1/items", req, &resp)
+func (s *ServiceClient) WithHedge(policy HedgePolicy) *ServiceClient {
+	c := *s
+	policy = policy.normalize()
+	c.hedge = &policy
+	if s.hedgeBudget == nil || s.hedge == nil || s.hedge.MaxRatio != policy.MaxRatio {
+		c.hedgeBudget = newRetryBudget(policy.MaxRatio, DefaultMinRetries)
+	}
+	return &c
+}
+
+type hedgeResult struct {
+	body     []byte
+	httpCode int
+	err      error
+}
+
+func (r hedgeResult) success() bool {
+	return r.err == nil && r.httpCode < http.StatusInternalServerError
+}
+
+// hedgedSend 发送对冲请求, 所有实例都被熔断时返回 false
+func (s *ServiceClient) hedgedSend(c *call, serviceArray []etcdx.ServiceInfo, idx *int, rejected **breaker.Breaker) (body []byte, httpCode int, err error, ok bool) {
+	service, brk, ok := s.pick(serviceArray, idx, rejected, &err)
+	if !ok {
+		return nil, 0, err, false
+	}
+	s.hedgeBudget.deposit()
+
+	// 拿到结果后取消其余在途请求, 这些被取消的请求不计入健康状态和熔断
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+	results := make(chan hedgeResult, 1+s.hedge.MaxHedges)
+	launch := func(service etcdx.ServiceInfo, brk *breaker.Breaker, hedged bool) {
+		go func() {
+			var r hedgeResult
+			r.body, r.httpCode, r.err = s.send(ctx, c, service, brk, hedged)
+			results <- r
+		}()
+	}
+	launch(service, brk, false)
+
+	delay := s.hedge.Delay
+	if delay <= 0 {
+		delay = s.latency.p95(c.serviceName)
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var last hedgeResult
+	pending, hedges := 1, 0
+	for {
+		select {
+		case r := <-results:
+			pending--
+			if r.success() {
+				return r.body, r.httpCode, r.err, true
+			}
+			last = r
+			// 没有在途的请求了, 交给重试处理
+			if pending == 0 {
+				return last.body, last.httpCode, last.err, true
+			}
+		case <-timer.C:
+			if hedges >= s.hedge.MaxHedges || len(serviceArray) < 2 || !s.hedgeBudget.withdraw() {
+				continue
+			}
+			*idx++
+			var e error
+			next, nextBrk, ok := s.pick(serviceArray, idx, rejected, &e)
+			if !ok {
+				continue
+			}
+			hedges++
+			pending++
+			launch(next, nextBrk, true)
+			timer.Reset(delay)
+		}
+	}
+}
+
+// latencyTracker 记录每个服务最近成功请求的耗时, 用于计算对冲请求的等待时间
+type latencyTracker struct {
+	mu       sync.Mutex
+	services map[string]*latencyRing
+}
+
+type latencyRing struct {
+	samples []time.Duration
+	pos     int
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{services: make(map[string]*latencyRing)}
+}
+
+func (t *latencyTracker) observe(service string, cost time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.services[service]
+	if !ok {
+		r = &latencyRing{samples: make([]time.Duration, 0, latencyWindow)}
+		t.services[service] = r
+	}
+	if len(r.samples) < latencyWindow {
+		r.samples = append(r.samples, cost)
+		return
+	}
+	r.samples[r.pos] = cost
+	r.pos = (r.pos + 1) % latencyWindow
+}
+
+// p95 最近请求耗时的 p95, 样本不足时返回 DefaultHedgeDelay
+func (t *latencyTracker) p95(service string) time.Duration {
+	t.mu.Lock()
+	r, ok := t.services[service]
+	if !ok || len(r.samples) < DefaultHedgeMinCount {
+		t.mu.Unlock()
+		return DefaultHedgeDelay
+	}
+	samples := append([]time.Duration(nil), r.samples...)
+	t.mu.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+	return samples[len(samples)*95/100]
+}
@@ -0,0 +1,102 @@
+package httpDiscover
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/datax/etcdx"
+	"github.com/chenxinqun/ginWarpPkg/httpx/breaker"
+)
+
+func slowHandler(d time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(d):
+		case <-r.Context().Done():
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0,"data":"slow"}`))
+	}
+}
+
+// fixedOrder 按实例列表原有的顺序选择, 方便控制第一个请求的实例
+func fixedOrder(l []etcdx.ServiceRegister) interface{} {
+	ret := make([]etcdx.ServiceInfo, 0, len(l))
+	for _, sr := range l {
+		ret = append(ret, sr.Val)
+	}
+	return ret
+}
+
+func waitIdle(t *testing.T, s *ServiceClient, service etcdx.ServiceInfo) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for s.InFlight().Count(service) > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	// 请求结束后还要记录健康状态和熔断
+	time.Sleep(20 * time.Millisecond)
+}
+
+func failures(s *ServiceClient, service etcdx.ServiceInfo) int {
+	for _, h := range s.HealthStates() {
+		if h.Url == service.Url() {
+			return h.ConsecutiveErrors
+		}
+	}
+	return 0
+}
+
+func TestHedgeCancelNotCountedAsFailure(t *testing.T) {
+	slow := newTestInstance(t, "search", slowHandler(time.Second))
+	fast := newTestInstance(t, "search", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0,"data":"fast"}`))
+	})
+	s, _ := newTestClient(Resource{
+		Breaker: &breaker.Config{Name: "hedge", WindowSize: 1, MinRequests: 1, OpenTimeout: time.Minute},
+		Health:  HealthConfig{ConsecutiveErrors: 1},
+	})
+	s.SetDiscoverer(NewMemoryDiscoverer(slow, fast))
+	s.SetBalancer(fixedOrder)
+
+	got, err := CallWith[struct{}, string](s.WithHedge(HedgePolicy{Delay: 20 * time.Millisecond}), context.Background(), "search", http.MethodGet, "/items", struct{}{})
+	if err != nil || got != "fast" {
+		t.Fatalf("CallWith() = %s, %v", got, err)
+	}
+	waitIdle(t, s, slow)
+	if n := failures(s, slow); n != 0 {
+		t.Errorf("hedge cancelled request counted as failure: %d", n)
+	}
+	if st := s.breakers.States()[instanceKey(slow)]; st != breaker.StateClosed {
+		t.Errorf("breaker of cancelled instance is %s", st)
+	}
+}
+
+func TestCallerDoneNotCountedAsFailure(t *testing.T) {
+	slow := newTestInstance(t, "search", slowHandler(time.Second))
+	s, _ := newTestClient(Resource{
+		Retry:   &RetryPolicy{MaxAttempts: 1},
+		Breaker: &breaker.Config{Name: "deadline", WindowSize: 1, MinRequests: 1, OpenTimeout: time.Minute},
+		Health:  HealthConfig{ConsecutiveErrors: 1},
+	}, slow)
+
+	// 调用方超时和主动取消都不计入实例的失败
+	timeout, cancelTimeout := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelTimeout()
+	canceled, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	for _, ctx := range []context.Context{timeout, canceled} {
+		if _, err := CallWith[struct{}, string](s, ctx, "search", http.MethodGet, "/items", struct{}{}); err == nil {
+			t.Fatal("want caller context error")
+		}
+		waitIdle(t, s, slow)
+	}
+	if n := failures(s, slow); n != 0 {
+		t.Errorf("caller context error counted as failure: %d", n)
+	}
+	if st := s.breakers.States()[instanceKey(slow)]; st != breaker.StateClosed {
+		t.Errorf("breaker should stay closed after caller context error, got %s", st)
+	}
+}
@@ -5,11 +5,16 @@ import (
 	"github.com/chenxinqun/ginWarpPkg/loggerx"
 )
 
+// CreateSpecialHttpClient 创建本地调试用的客户端, 传了 Resource.Discoverer 时不连接 etcd
 func CreateSpecialHttpClient(rs ...Resource) *ServiceClient {
 	var r Resource
 	if len(rs) > 0 {
 		r = rs[0]
 	}
+	if r.Discoverer != nil {
+		loggerx.CreateSpecialLogger()
+		return New(r)
+	}
 	if r.ServerName == "" {
 		r.ServerName = "test"
 	}
@@ -1,40 +1,56 @@
 package httpDiscover
 
 import (
-	"encoding/json"
-	mux "github.com/chenxinqun/ginWarpPkg/httpx/mux"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"testing"
+
+	"github.com/chenxinqun/ginWarpPkg/datax/etcdx"
+	"github.com/chenxinqun/ginWarpPkg/httpx/mux"
 )
 
+// newTestInstance 启动一个 httptest 服务, 返回对应的服务实例信息
+func newTestInstance(t *testing.T, name string, handler http.HandlerFunc) etcdx.ServiceInfo {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+	return etcdx.ServiceInfo{ID: u.Host, Name: name, Scheme: "http", Addr: u.Hostname(), Port: port}
+}
+
+// newTestClient 使用内存服务发现的客户端, 关闭后台健康探测
+func newTestClient(r Resource, services ...etcdx.ServiceInfo) (*ServiceClient, *MemoryDiscoverer) {
+	d := NewMemoryDiscoverer(services...)
+	r.Discoverer = d
+	r.Health.Interval = -1
+	return CreateSpecialHttpClient(r), d
+}
+
 func TestCreateSpecialHttpClient(t *testing.T) {
-	type args struct {
-		rs []Resource
-	}
-	tests := []struct {
-		name string
-		args args
-	}{
-		{name: "aaa", args: args{}},
+	instance := newTestInstance(t, "fc-intrusion", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/system/health" || r.Header.Get(mux.UserName) != "-1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0,"data":{"status":"ok"}}`))
+	})
+	got, _ := newTestClient(Resource{}, instance)
+	ctx := mux.CreateSpecialContext(mux.SpecialContextResource{
+		UserID:   -1,
+		UserName: "-1",
+		TenantID: -1,
+		IsAdmin:  false,
+		RoleType: -1,
+	})
+	ret := make(map[string]interface{})
+	code, err := got.GetJson(ctx, "fc-intrusion", "/system/health", struct{}{}, &ret)
+	if err != nil {
+		t.Fatal(err)
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := CreateSpecialHttpClient(tt.args.rs...)
-			t.Log(got)
-			ctx := mux2.CreateSpecialContext(mux2.SpecialContextResource{
-				UserID:   -1,
-				UserName: "-1",
-				TenantID: -1,
-				IsAdmin:  false,
-				RoleType: -1,
-			})
-			ret := make(map[string]interface{})
-			code, err := got.GetJson(ctx, "fc-intrusion", "/system/health", struct{}{}, &ret)
-			if err != nil {
-				t.Fatal(err)
-			}
-			r, _ := json.Marshal(ret)
-			t.Log(code, r)
-
-		})
+	if code != http.StatusOK {
+		t.Fatalf("code = %d, ret = %v", code, ret)
 	}
 }
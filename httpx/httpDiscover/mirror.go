@@ -0,0 +1,313 @@
+package httpDiscover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/datax/etcdx"
+	"github.com/chenxinqun/ginWarpPkg/errno"
+	"github.com/chenxinqun/ginWarpPkg/httpx/httpClient"
+	"github.com/chenxinqun/ginWarpPkg/httpx/mux"
+	"github.com/chenxinqun/ginWarpPkg/httpx/trace"
+	"github.com/chenxinqun/ginWarpPkg/metrics"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// MirrorHeader 镜像请求会带上这个请求头, 下游可以据此跳过发消息, 扣费等有副作用的操作
+	MirrorHeader = "X-Mirrored-Request"
+
+	DefaultMirrorConcurrency = 10
+
+	// 镜像请求的对比结果
+	MirrorMatch      = "match"
+	MirrorStatusDiff = "status_diff"
+	MirrorCodeDiff   = "code_diff"
+	MirrorBodyDiff   = "body_diff"
+	MirrorError      = "error"
+	MirrorDropped    = "dropped"
+
+	maxMirrorDiffs = 10
+)
+
+// MirrorPolicy 流量镜像策略. 按比例把请求异步复制一份发到版本或标签匹配的实例上, 镜像的响应直接丢弃,
+// 只和正常响应对比, 差异记录到日志和 metrics.RecordMirror. 目标实例不接收正常流量.
+type MirrorPolicy struct {
+	// Name 指标和日志中的名称, 不填时使用 Version
+	Name string `toml:"name" json:"name"`
+	// Service 生效的服务名称, 不填或者填 * 对所有服务生效
+	Service string `toml:"service" json:"service"`
+	// Percent 镜像的比例, 取值 0 ~ 100
+	Percent float64 `toml:"percent" json:"percent"`
+	// Version 目标实例的版本, 匹配 ServiceInfo.ProjectVersion 或 ServiceInfo.ApiVersion
+	Version string `toml:"version" json:"version"`
+	// Tags 目标实例的标签, 需要和 ServiceInfo.Meta 全部匹配
+	Tags map[string]string `toml:"tags" json:"tags"`
+	// AllowNonIdempotent 是否镜像 GET, HEAD 之外的请求, 默认不镜像, 避免重复写入
+	AllowNonIdempotent bool `toml:"allowNonIdempotent" json:"allowNonIdempotent"`
+	// CompareBody 是否对比 Result.Data 的 json 内容, 默认只对比状态码和业务码
+	CompareBody bool `toml:"compareBody" json:"compareBody"`
+	// IgnoreFields 对比 json 时忽略的字段, 嵌套字段用 . 分隔, 如 updatedAt, page.requestId
+	IgnoreFields []string `toml:"ignoreFields" json:"ignoreFields"`
+	// Timeout 镜像请求的超时时间, 默认与客户端的超时时间相同
+	Timeout time.Duration `toml:"timeout" json:"timeout"`
+	// MaxConcurrency 同时在途的镜像请求数, 超过时丢弃, 默认 10
+	MaxConcurrency int `toml:"maxConcurrency" json:"maxConcurrency"`
+}
+
+func (p MirrorPolicy) validate() error {
+	if p.Version == "" && len(p.Tags) == 0 {
+		return errno.Errorf("mirror policy `%s`: version or tags required", p.Name)
+	}
+	if p.Percent < 0 || p.Percent > 100 {
+		return errno.Errorf("mirror policy `%s`: percent must be between 0 and 100", p.Name)
+	}
+	return nil
+}
+
+func (p MirrorPolicy) target(s etcdx.ServiceInfo) bool {
+	return RouteRule{Version: p.Version, Tags: p.Tags}.target(s)
+}
+
+func (p MirrorPolicy) forService(name string) bool {
+	return p.Service == "" || p.Service == "*" || p.Service == name
+}
+
+// mirrorer 保存镜像策略和每个策略的并发限制
+type mirrorer struct {
+	mu       sync.RWMutex
+	policies []*mirrorState
+}
+
+type mirrorState struct {
+	policy MirrorPolicy
+	sem    chan struct{}
+}
+
+// mirrorTask 一次需要镜像的请求
+type mirrorTask struct {
+	state   *mirrorState
+	targets []etcdx.ServiceInfo
+}
+
+// SetMirror 设置流量镜像策略, 策略不合法时保留原策略, 不传时关闭镜像
+func (s *ServiceClient) SetMirror(policies ...MirrorPolicy) error {
+	states := make([]*mirrorState, 0, len(policies))
+	for _, p := range policies {
+		if err := p.validate(); err != nil {
+			return err
+		}
+		if p.Name == "" {
+			p.Name = p.Version
+		}
+		if p.Timeout <= 0 {
+			p.Timeout = s.timeout
+		}
+		if p.MaxConcurrency <= 0 {
+			p.MaxConcurrency = DefaultMirrorConcurrency
+		}
+		states = append(states, &mirrorState{policy: p, sem: make(chan struct{}, p.MaxConcurrency)})
+	}
+	s.mirror.mu.Lock()
+	s.mirror.policies = states
+	s.mirror.mu.Unlock()
+	return nil
+}
+
+// match 从服务列表中排除镜像的目标实例, 并按比例抽样返回需要镜像的任务. 排除后没有实例时使用全部实例
+func (m *mirrorer) match(service, method string, serviceArray []etcdx.ServiceInfo) (*mirrorTask, []etcdx.ServiceInfo) {
+	if m == nil {
+		return nil, serviceArray
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var task *mirrorTask
+	rest := serviceArray
+	for _, st := range m.policies {
+		if !st.policy.forService(service) {
+			continue
+		}
+		targets := make([]etcdx.ServiceInfo, 0)
+		others := make([]etcdx.ServiceInfo, 0, len(rest))
+		for _, s := range rest {
+			if st.policy.target(s) {
+				targets = append(targets, s)
+			} else {
+				others = append(others, s)
+			}
+		}
+		if len(others) > 0 {
+			rest = others
+		}
+		if task != nil || len(targets) == 0 || !st.policy.allow(method) {
+			continue
+		}
+		if float64(etcdx.RandIntn(10000)) < st.policy.Percent*100 {
+			task = &mirrorTask{state: st, targets: targets}
+		}
+	}
+	return task, rest
+}
+
+func (p MirrorPolicy) allow(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	}
+	return p.AllowNonIdempotent
+}
+
+// runMirror 异步发送镜像请求并和正常请求的结果对比, 不影响正常请求
+func (s *ServiceClient) runMirror(task *mirrorTask, c *call, body []byte, httpCode int, err error) {
+	p := task.state.policy
+	// 正常请求没有响应时没有对比的意义
+	if httpCode == 0 {
+		return
+	}
+	select {
+	case task.state.sem <- struct{}{}:
+	default:
+		metrics.RecordMirror(c.serviceName, p.Name, MirrorDropped)
+		return
+	}
+	primary := append([]byte(nil), body...)
+	target := task.targets[etcdx.RandIntn(len(task.targets))]
+	// 镜像请求在后台执行, 不能写入正常请求的链路, 使用同一个链路ID的子链路, 下游仍然可以关联
+	var traceID string
+	if t := mux.TraceFromContext(c.ctx); t != nil {
+		traceID = t.ID()
+	}
+	mt := trace.New(traceID)
+	go func() {
+		defer func() {
+			<-task.state.sem
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+		defer cancel()
+		mc := *c
+		mc.ctx, mc.attempt, mc.mirror = ctx, 1, true
+		mc.handlers = append(c.handlers[:len(c.handlers):len(c.handlers)], httpClient.WithTrace(mt))
+		mBody, mCode, mErr := s.send(ctx, &mc, target, nil, false)
+
+		result, diffs := compareMirror(p, httpCode, primary, mCode, mBody, mErr)
+		metrics.RecordMirror(c.serviceName, p.Name, result)
+		if result == MirrorMatch {
+			return
+		}
+		s.logger.Warn("镜像请求结果不一致",
+			zap.String("service name", c.serviceName),
+			zap.String("mirror", p.Name),
+			zap.String("instance", target.Url()),
+			zap.String("path", c.urlPath),
+			zap.String("result", result),
+			zap.Int("status", httpCode),
+			zap.Int("mirror status", mCode),
+			zap.Strings("diffs", diffs),
+			zap.Any("trace_info", mt),
+			zap.Error(mErr),
+		)
+	}()
+}
+
+// compareMirror 依次对比状态码, 业务码和 Result.Data, 返回第一个不一致的结果
+func compareMirror(p MirrorPolicy, code int, body []byte, mCode int, mBody []byte, mErr error) (string, []string) {
+	if mCode == 0 && mErr != nil {
+		return MirrorError, nil
+	}
+	if code != mCode {
+		return MirrorStatusDiff, []string{fmt.Sprintf("status: %d != %d", code, mCode)}
+	}
+	primary, mirror := new(httpClient.Envelope), new(httpClient.Envelope)
+	if json.Unmarshal(body, primary) != nil || json.Unmarshal(mBody, mirror) != nil {
+		// 不是 Result 格式时, 只在开启了 CompareBody 时对比原始内容
+		if p.CompareBody && string(body) != string(mBody) {
+			return MirrorBodyDiff, []string{"body"}
+		}
+		return MirrorMatch, nil
+	}
+	if primary.Code != mirror.Code {
+		return MirrorCodeDiff, []string{fmt.Sprintf("code: %d != %d", primary.Code, mirror.Code)}
+	}
+	if !p.CompareBody {
+		return MirrorMatch, nil
+	}
+	var a, b interface{}
+	_ = json.Unmarshal(primary.Data, &a)
+	_ = json.Unmarshal(mirror.Data, &b)
+	for _, field := range p.IgnoreFields {
+		path := strings.Split(field, ".")
+		removeField(a, path)
+		removeField(b, path)
+	}
+	diffs := make([]string, 0)
+	diffJSON(a, b, "data", &diffs)
+	if len(diffs) > 0 {
+		return MirrorBodyDiff, diffs
+	}
+	return MirrorMatch, nil
+}
+
+// removeField 删除 json 对象中的字段, 遇到数组时对每个元素处理
+func removeField(v interface{}, path []string) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			delete(val, path[0])
+			return
+		}
+		removeField(val[path[0]], path[1:])
+	case []interface{}:
+		for _, item := range val {
+			removeField(item, path)
+		}
+	}
+}
+
+// diffJSON 记录两个 json 值中不一致的字段路径, 最多 maxMirrorDiffs 个
+func diffJSON(a, b interface{}, path string, diffs *[]string) {
+	if len(*diffs) >= maxMirrorDiffs {
+		return
+	}
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			diffJSON(av[k], bv[k], path+"."+k, diffs)
+		}
+		return
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			break
+		}
+		for i := range av {
+			diffJSON(av[i], bv[i], fmt.Sprintf("%s[%d]", path, i), diffs)
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		*diffs = append(*diffs, path)
+	}
+}
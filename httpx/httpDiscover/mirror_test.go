@@ -0,0 +1,126 @@
+package httpDiscover
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/httpx/trace"
+)
+
+func TestMirrorPolicyAllow(t *testing.T) {
+	methods := []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+	for _, m := range methods {
+		want := m == http.MethodGet || m == http.MethodHead
+		if got := (MirrorPolicy{}).allow(m); got != want {
+			t.Errorf("allow(%s) = %v, want %v", m, got, want)
+		}
+		if !(MirrorPolicy{AllowNonIdempotent: true}).allow(m) {
+			t.Errorf("allow(%s) with AllowNonIdempotent = false", m)
+		}
+	}
+}
+
+func TestCompareMirror(t *testing.T) {
+	compare := MirrorPolicy{CompareBody: true, IgnoreFields: []string{"ts", "list.ts"}}
+	cases := []struct {
+		name   string
+		policy MirrorPolicy
+		code   int
+		body   string
+		mCode  int
+		mBody  string
+		mErr   error
+		want   string
+		diffs  []string
+	}{
+		{"mirror error", compare, 200, `{}`, 0, "", errors.New("refused"), MirrorError, nil},
+		{"status", compare, 200, `{}`, 500, `{}`, nil, MirrorStatusDiff, []string{"status: 200 != 500"}},
+		{"code", compare, 200, `{"code":0}`, 200, `{"code":1}`, nil, MirrorCodeDiff, []string{"code: 0 != 1"}},
+		{"data ignored", MirrorPolicy{}, 200, `{"code":0,"data":{"a":1}}`, 200, `{"code":0,"data":{"a":2}}`, nil, MirrorMatch, nil},
+		{"data", compare, 200, `{"code":0,"data":{"a":1,"b":1}}`, 200, `{"code":0,"data":{"a":2,"b":1}}`, nil, MirrorBodyDiff, []string{"data.a"}},
+		{"ignore fields", compare, 200, `{"code":0,"data":{"ts":1,"list":[{"ts":1,"x":1}]}}`, 200, `{"code":0,"data":{"ts":2,"list":[{"ts":2,"x":1}]}}`, nil, MirrorMatch, nil},
+		{"nested ignore", compare, 200, `{"code":0,"data":{"list":[{"ts":1,"x":1}]}}`, 200, `{"code":0,"data":{"list":[{"ts":2,"x":2}]}}`, nil, MirrorBodyDiff, []string{"data.list[0].x"}},
+		{"raw body", compare, 200, `plain`, 200, `other`, nil, MirrorBodyDiff, []string{"body"}},
+		{"raw body not compared", MirrorPolicy{}, 200, `plain`, 200, `other`, nil, MirrorMatch, nil},
+	}
+	for _, c := range cases {
+		got, diffs := compareMirror(c.policy, c.code, []byte(c.body), c.mCode, []byte(c.mBody), c.mErr)
+		if got != c.want || !reflect.DeepEqual(diffs, c.diffs) {
+			t.Errorf("%s: compareMirror = %s %v, want %s %v", c.name, got, diffs, c.want, c.diffs)
+		}
+	}
+}
+
+func TestDiffJSON(t *testing.T) {
+	many := func(n int, v float64) map[string]interface{} {
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			m[string(rune('a'+i))] = v
+		}
+		return m
+	}
+	cases := []struct {
+		name string
+		a, b interface{}
+		want []string
+	}{
+		{"equal", map[string]interface{}{"a": 1.0}, map[string]interface{}{"a": 1.0}, []string{}},
+		{"missing key", map[string]interface{}{"a": 1.0}, map[string]interface{}{"b": 1.0}, []string{"data.a", "data.b"}},
+		{"type", map[string]interface{}{"a": 1.0}, map[string]interface{}{"a": "1"}, []string{"data.a"}},
+		{"array element", []interface{}{1.0, 2.0}, []interface{}{1.0, 3.0}, []string{"data[1]"}},
+		{"array length", []interface{}{1.0}, []interface{}{1.0, 2.0}, []string{"data"}},
+		{"object and array", map[string]interface{}{}, []interface{}{}, []string{"data"}},
+		{"max diffs", many(20, 1), many(20, 2), []string{"data.a", "data.b", "data.c", "data.d", "data.e", "data.f", "data.g", "data.h", "data.i", "data.j"}},
+	}
+	for _, c := range cases {
+		diffs := make([]string, 0)
+		diffJSON(c.a, c.b, "data", &diffs)
+		if !reflect.DeepEqual(diffs, c.want) {
+			t.Errorf("%s: diffJSON = %v, want %v", c.name, diffs, c.want)
+		}
+	}
+}
+
+func TestMirrorTrace(t *testing.T) {
+	mirrored := make(chan string, 10)
+	stable := newTestInstance(t, "search", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0,"data":1}`))
+	})
+	canary := newTestInstance(t, "search", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(MirrorHeader) == "1" {
+			mirrored <- r.Method + " " + r.Header.Get(trace.Header)
+		}
+		_, _ = w.Write([]byte(`{"code":0,"data":1}`))
+	})
+	canary.ProjectVersion = "v2"
+	s, _ := newTestClient(Resource{Mirror: []MirrorPolicy{{Version: "v2", Percent: 100}}}, stable, canary)
+
+	tr := trace.New("")
+	ctx := trace.NewContext(context.Background(), tr)
+	if _, err := CallWith[struct{}, int](s, ctx, "search", http.MethodPost, "/items", struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CallWith[struct{}, int](s, ctx, "search", http.MethodGet, "/items", struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-mirrored:
+		if got != http.MethodGet+" "+tr.ID() {
+			t.Errorf("mirrored request = %s", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request not mirrored")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if len(mirrored) != 0 {
+		t.Errorf("non idempotent request mirrored")
+	}
+	// 镜像请求不写入调用方的链路
+	if len(tr.ThirdPartyRequests) != 2 {
+		t.Errorf("want 2 dialogs in caller trace, got %d", len(tr.ThirdPartyRequests))
+	}
+}
@@ -0,0 +1,179 @@
+package httpDiscover
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/datax/etcdx"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// RetryAttemptHeader 重试时带上第几次请求, 从 1 开始, 会同时记录在链路的 dialog 中
+	RetryAttemptHeader = "X-Retry-Attempt"
+	// IdempotencyKeyHeader 请求头中带有幂等键时, POST 和 PATCH 也视为可以重试
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	DefaultRetryBudgetRatio = 0.2
+	DefaultMinRetries       = 10
+	DefaultMaxRetryBackoff  = 30 * time.Second
+)
+
+// DefaultRetryableCodes 默认重试的 HTTP 状态码
+var DefaultRetryableCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryPolicy ServiceClient 的重试策略
+type RetryPolicy struct {
+	// MaxAttempts 最多请求次数, 包括第一次请求, 1 为不重试
+	MaxAttempts int `toml:"maxAttempts" json:"maxAttempts"`
+	// Backoff 第一次重试前的等待时间, 之后每次翻倍, 最长 MaxBackoff. 会自动加上[10,100)毫秒的随机数
+	Backoff    time.Duration `toml:"backoff" json:"backoff"`
+	MaxBackoff time.Duration `toml:"maxBackoff" json:"maxBackoff"`
+	// RetryableCodes 需要重试的 HTTP 状态码, 不填使用 DefaultRetryableCodes
+	RetryableCodes []int `toml:"retryableCodes" json:"retryableCodes"`
+	// NoRetryOnTimeout 超时不重试
+	NoRetryOnTimeout bool `toml:"noRetryOnTimeout" json:"noRetryOnTimeout"`
+	// NoRetryOnConnError 连接失败等没有拿到响应的错误不重试
+	NoRetryOnConnError bool `toml:"noRetryOnConnError" json:"noRetryOnConnError"`
+	// NoFailover 重试时仍然请求同一个实例, 默认换下一个实例
+	NoFailover bool `toml:"noFailover" json:"noFailover"`
+	// RetryNonIdempotent POST 和 PATCH 也重试. 不开启时, 只有连接被拒绝(请求没有发出去)或者带了 IdempotencyKeyHeader 才重试
+	RetryNonIdempotent bool `toml:"retryNonIdempotent" json:"retryNonIdempotent"`
+	// BudgetRatio 重试预算, 重试请求数最多为总请求数的这个比例, 避免故障时重试放大流量. 小于 0 时不限制
+	BudgetRatio float64 `toml:"budgetRatio" json:"budgetRatio"`
+	// MinRetries 请求量很小时, 也至少允许这么多次重试
+	MinRetries int `toml:"minRetries" json:"minRetries"`
+}
+
+func (p RetryPolicy) normalize() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultRetryCount + 1
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultMaxRetryBackoff
+	}
+	if len(p.RetryableCodes) == 0 {
+		p.RetryableCodes = DefaultRetryableCodes
+	}
+	if p.BudgetRatio == 0 {
+		p.BudgetRatio = DefaultRetryBudgetRatio
+	}
+	if p.MinRetries <= 0 {
+		p.MinRetries = DefaultMinRetries
+	}
+	return p
+}
+
+// backoff 第 attempt 次重试前的等待时间, attempt 从 1 开始
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.Backoff << uint(attempt-1)
+	// 重试次数很多时左移会溢出
+	if d > p.MaxBackoff || d < 0 || d>>uint(attempt-1) != p.Backoff {
+		d = p.MaxBackoff
+	}
+	return d + time.Duration(10+etcdx.RandIntn(90))*time.Millisecond
+}
+
+// wait 等待 d 之后再重试, 调用方取消或者超时时立即返回 ctx 的错误
+func wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// idempotent 请求是否可以安全的重复发送
+func (p RetryPolicy) idempotent(method string, header http.Header) bool {
+	switch method {
+	case http.MethodPost, http.MethodPatch:
+		return p.RetryNonIdempotent || header.Get(IdempotencyKeyHeader) != ""
+	}
+	return true
+}
+
+// retryable 根据响应判断是否需要重试, 非幂等的请求只在请求确定没有发出去时重试
+func (p RetryPolicy) retryable(idempotent bool, httpCode int, err error, body []byte, verify []RetryVerify) bool {
+	if !idempotent {
+		return httpCode == 0 && errors.Is(err, syscall.ECONNREFUSED) && !p.NoRetryOnConnError
+	}
+	if isTimeout(err) {
+		return !p.NoRetryOnTimeout
+	}
+	if httpCode == 0 && err != nil {
+		return !p.NoRetryOnConnError
+	}
+	for _, code := range p.RetryableCodes {
+		if code == httpCode {
+			return true
+		}
+	}
+	for _, retry := range verify {
+		if retry(body) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryBudget 重试预算, 每个请求存入 ratio 个令牌, 每次重试消耗一个令牌
+type retryBudget struct {
+	mu     sync.Mutex
+	ratio  float64
+	max    float64
+	tokens float64
+}
+
+func newRetryBudget(ratio float64, minRetries int) *retryBudget {
+	return &retryBudget{ratio: ratio, max: float64(minRetries), tokens: float64(minRetries)}
+}
+
+func (b *retryBudget) deposit() {
+	if b.ratio < 0 {
+		return
+	}
+	b.mu.Lock()
+	b.tokens += b.ratio
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+	b.mu.Unlock()
+}
+
+func (b *retryBudget) withdraw() bool {
+	if b.ratio < 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// WithRetry 返回使用指定重试策略的 ServiceClient, 用于单次调用覆盖默认策略, 其它状态(熔断, 健康检查等)共用.
+//
+//	client.WithRetry(httpDiscover.RetryPolicy{MaxAttempts: 1}).PostJson(ctx, "user", "/v1/users", req, &resp)
+func (s *ServiceClient) WithRetry(policy RetryPolicy) *ServiceClient {
+	c := *s
+	c.retry = policy.normalize()
+	if c.retry.BudgetRatio != s.retry.BudgetRatio || c.retry.MinRetries != s.retry.MinRetries {
+		c.budget = newRetryBudget(c.retry.BudgetRatio, c.retry.MinRetries)
+	}
+	return &c
+}
@@ -0,0 +1,155 @@
+package httpDiscover
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	refused := &url.Error{Op: "Get", URL: "http://127.0.0.1:1", Err: syscall.ECONNREFUSED}
+	timeout := &url.Error{Op: "Get", URL: "http://127.0.0.1:1", Err: context.DeadlineExceeded}
+	reset := errors.New("connection reset by peer")
+	verify := func(body []byte) bool {
+		return string(body) == "retry"
+	}
+	p := RetryPolicy{}.normalize()
+
+	cases := []struct {
+		name       string
+		policy     RetryPolicy
+		idempotent bool
+		httpCode   int
+		err        error
+		body       string
+		want       bool
+	}{
+		{"ok", p, true, http.StatusOK, nil, "", false},
+		{"retryable code", p, true, http.StatusServiceUnavailable, errors.New("503"), "", true},
+		{"not retryable code", p, true, http.StatusInternalServerError, errors.New("500"), "", false},
+		{"custom code", RetryPolicy{RetryableCodes: []int{http.StatusInternalServerError}}.normalize(), true, http.StatusInternalServerError, errors.New("500"), "", true},
+		{"timeout", p, true, 0, timeout, "", true},
+		{"no retry on timeout", RetryPolicy{NoRetryOnTimeout: true}.normalize(), true, 0, timeout, "", false},
+		{"conn error", p, true, 0, reset, "", true},
+		{"no retry on conn error", RetryPolicy{NoRetryOnConnError: true}.normalize(), true, 0, reset, "", false},
+		{"verify body", p, true, http.StatusOK, nil, "retry", true},
+		{"non idempotent refused", p, false, 0, refused, "", true},
+		{"non idempotent reset", p, false, 0, reset, "", false},
+		{"non idempotent 503", p, false, http.StatusServiceUnavailable, errors.New("503"), "", false},
+		{"non idempotent timeout", p, false, 0, timeout, "", false},
+		{"non idempotent refused disabled", RetryPolicy{NoRetryOnConnError: true}.normalize(), false, 0, refused, "", false},
+	}
+	for _, c := range cases {
+		got := c.policy.retryable(c.idempotent, c.httpCode, c.err, []byte(c.body), []RetryVerify{verify})
+		if got != c.want {
+			t.Errorf("%s: retryable = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRetryPolicyIdempotent(t *testing.T) {
+	withKey := http.Header{}
+	withKey.Set(IdempotencyKeyHeader, "k1")
+	cases := []struct {
+		method string
+		policy RetryPolicy
+		header http.Header
+		want   bool
+	}{
+		{http.MethodGet, RetryPolicy{}, nil, true},
+		{http.MethodPut, RetryPolicy{}, nil, true},
+		{http.MethodDelete, RetryPolicy{}, nil, true},
+		{http.MethodPost, RetryPolicy{}, nil, false},
+		{http.MethodPatch, RetryPolicy{}, nil, false},
+		{http.MethodPost, RetryPolicy{}, withKey, true},
+		{http.MethodPatch, RetryPolicy{RetryNonIdempotent: true}, nil, true},
+	}
+	for _, c := range cases {
+		if got := c.policy.idempotent(c.method, c.header); got != c.want {
+			t.Errorf("%s %v: idempotent = %v, want %v", c.method, c.header, got, c.want)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}.normalize()
+	cases := []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{70, time.Second},
+	}
+	for _, c := range cases {
+		for i := 0; i < 20; i++ {
+			got := p.backoff(c.attempt)
+			if got < c.base+10*time.Millisecond || got >= c.base+100*time.Millisecond {
+				t.Fatalf("backoff(%d) = %s, want [%s, %s)", c.attempt, got, c.base+10*time.Millisecond, c.base+100*time.Millisecond)
+			}
+		}
+	}
+}
+
+func TestRetryBackoffCanceled(t *testing.T) {
+	failing := newTestInstance(t, "order", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	s, _ := newTestClient(Resource{Retry: &RetryPolicy{MaxAttempts: 2, Backoff: time.Minute, MaxBackoff: time.Minute}}, failing)
+
+	// 等待重试的时候调用方取消, 不用等到退避时间结束
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	ts := time.Now()
+	_, err := CallWith[struct{}, struct{}](s, ctx, "order", http.MethodGet, "/orders", struct{}{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CallWith() error = %v, want context deadline exceeded", err)
+	}
+	if cost := time.Since(ts); cost > time.Second {
+		t.Errorf("backoff ignored caller context, took %s", cost)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	cases := []struct {
+		name       string
+		ratio      float64
+		minRetries int
+		deposits   int
+		withdraws  int
+		want       int
+	}{
+		{"min retries", 0.2, 3, 0, 5, 3},
+		{"deposit", 0.5, 10, 4, 5, 2},
+		{"capped", 0.5, 2, 100, 5, 2},
+		{"unlimited", -1, 0, 0, 5, 5},
+	}
+	for _, c := range cases {
+		b := newRetryBudget(c.ratio, c.minRetries)
+		// 先用掉初始令牌, 再存入令牌
+		if c.deposits > 0 {
+			for i := 0; i < c.minRetries; i++ {
+				b.withdraw()
+			}
+			for i := 0; i < c.deposits; i++ {
+				b.deposit()
+			}
+		}
+		got := 0
+		for i := 0; i < c.withdraws; i++ {
+			if b.withdraw() {
+				got++
+			}
+		}
+		if got != c.want {
+			t.Errorf("%s: withdraw %d times, want %d", c.name, got, c.want)
+		}
+	}
+}
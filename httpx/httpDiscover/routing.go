@@ -0,0 +1,243 @@
+package httpDiscover
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/chenxinqun/ginWarpPkg/datax/etcdx"
+	"github.com/chenxinqun/ginWarpPkg/errno"
+
+	"go.uber.org/zap"
+)
+
+// RouteTagHeader 命中路由规则后, 请求会带上规则名称, 下游服务收到后继续按同一个规则路由, 保证整条链路都走灰度版本
+const RouteTagHeader = "X-Route-Tag"
+
+// RouteRule 灰度路由规则, 满足任意一个匹配条件的请求, 会被发送到版本或标签匹配的实例上.
+//
+//	[{"name": "user-v2", "service": "user", "percent": 10, "tenants": [1001], "version": "v2.0"}]
+type RouteRule struct {
+	// Name 规则名称, 同时作为 RouteTagHeader 的值向下游传递
+	Name string `toml:"name" json:"name"`
+	// Service 规则对应的服务名称, 不填或者填 * 对所有服务生效
+	Service string `toml:"service" json:"service"`
+
+	// Percent 按比例灰度, 取值 0 ~ 100. 有用户或者租户ID时按ID哈希, 同一个用户总是落在同一边
+	Percent float64 `toml:"percent" json:"percent"`
+	// Tenants Users 指定的租户或者用户
+	Tenants []int64 `toml:"tenants" json:"tenants"`
+	Users   []int64 `toml:"users" json:"users"`
+	// Header HeaderValue 请求头匹配, HeaderValue 不填时只要带了这个请求头就匹配
+	Header      string `toml:"header" json:"header"`
+	HeaderValue string `toml:"headerValue" json:"headerValue"`
+
+	// Version 目标实例的版本, 匹配 ServiceInfo.ProjectVersion 或 ServiceInfo.ApiVersion
+	Version string `toml:"version" json:"version"`
+	// Tags 目标实例的标签, 需要和 ServiceInfo.Meta 全部匹配
+	Tags map[string]string `toml:"tags" json:"tags"`
+}
+
+func (r RouteRule) validate() error {
+	if r.Name == "" {
+		return errno.NewError("route rule name required")
+	}
+	if r.Version == "" && len(r.Tags) == 0 {
+		return errno.Errorf("route rule `%s`: version or tags required", r.Name)
+	}
+	if r.Percent < 0 || r.Percent > 100 {
+		return errno.Errorf("route rule `%s`: percent must be between 0 and 100", r.Name)
+	}
+	return nil
+}
+
+func (r RouteRule) forService(name string) bool {
+	return r.Service == "" || r.Service == "*" || r.Service == name
+}
+
+// RouteRequest 路由规则匹配时使用的请求信息
+type RouteRequest struct {
+	UserID   int64
+	TenantID int64
+	Header   http.Header
+}
+
+func (r RouteRule) match(req RouteRequest) bool {
+	if req.Header.Get(RouteTagHeader) == r.Name {
+		return true
+	}
+	for _, id := range r.Tenants {
+		if id == req.TenantID {
+			return true
+		}
+	}
+	for _, id := range r.Users {
+		if id == req.UserID {
+			return true
+		}
+	}
+	if r.Header != "" {
+		if v := req.Header.Get(r.Header); v != "" && (r.HeaderValue == "" || v == r.HeaderValue) {
+			return true
+		}
+	}
+	if r.Percent > 0 {
+		var bucket int
+		switch {
+		case req.UserID != 0:
+			bucket = hashBucket(r.Name, "u"+strconv.FormatInt(req.UserID, 10))
+		case req.TenantID != 0:
+			bucket = hashBucket(r.Name, "t"+strconv.FormatInt(req.TenantID, 10))
+		default:
+			bucket = etcdx.RandIntn(10000)
+		}
+		return float64(bucket) < r.Percent*100
+	}
+	return false
+}
+
+// hashBucket 把 key 哈希到 [0, 10000), 加上规则名称, 不同规则的灰度用户互不相关
+func hashBucket(salt, key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(salt))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % 10000)
+}
+
+// target 实例是否为规则的目标实例
+func (r RouteRule) target(s etcdx.ServiceInfo) bool {
+	if r.Version != "" && s.ProjectVersion != r.Version && s.ApiVersion != r.Version {
+		return false
+	}
+	for k, v := range r.Tags {
+		if s.Meta[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Router 灰度路由, 规则可以通过 SetRules 设置, 或者通过 Watch 从 etcd 配置中心热更新
+type Router struct {
+	mu     sync.RWMutex
+	rules  []RouteRule
+	logger *zap.Logger
+}
+
+func NewRouter(logger *zap.Logger, rules ...RouteRule) (*Router, error) {
+	r := &Router{logger: logger}
+	if err := r.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetRules 替换路由规则, 规则不合法时保留原规则
+func (r *Router) SetRules(rules []RouteRule) error {
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	r.rules = rules
+	r.mu.Unlock()
+	return nil
+}
+
+// Rules 当前的路由规则
+func (r *Router) Rules() []RouteRule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]RouteRule(nil), r.rules...)
+}
+
+// Route 按规则挑选实例, 返回命中的规则名称. 命中的规则没有可用实例时使用全部实例;
+// 没有命中规则的请求不会发送到灰度实例上, 除非只剩下灰度实例.
+func (r *Router) Route(service string, req RouteRequest, serviceArray []etcdx.ServiceInfo) (tag string, ret []etcdx.ServiceInfo) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rules := make([]RouteRule, 0)
+	for _, rule := range r.rules {
+		if rule.forService(service) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return "", serviceArray
+	}
+
+	for _, rule := range rules {
+		if !rule.match(req) {
+			continue
+		}
+		ret = make([]etcdx.ServiceInfo, 0, len(serviceArray))
+		for _, s := range serviceArray {
+			if rule.target(s) {
+				ret = append(ret, s)
+			}
+		}
+		if len(ret) == 0 {
+			r.logger.Warn("灰度规则没有匹配的实例, 使用全部实例", zap.String("rule", rule.Name), zap.String("service", service))
+			return rule.Name, serviceArray
+		}
+		return rule.Name, ret
+	}
+
+	// 没有命中规则, 排除灰度实例
+	ret = make([]etcdx.ServiceInfo, 0, len(serviceArray))
+	for _, s := range serviceArray {
+		canary := false
+		for _, rule := range rules {
+			if rule.target(s) {
+				canary = true
+				break
+			}
+		}
+		if !canary {
+			ret = append(ret, s)
+		}
+	}
+	if len(ret) == 0 {
+		return "", serviceArray
+	}
+	return "", ret
+}
+
+// Watch 从配置中心读取路由规则并监听变更, key 为 etcdx.ConfigInfo 前缀下的配置项, 值为 RouteRule 的 JSON 数组.
+// 需要先调用 repo.Configuring 设置配置前缀. 更新的规则不合法时记录日志并保留原规则, 配置删除时清空规则.
+// 返回停止监听的函数.
+func (r *Router) Watch(repo etcdx.Repo, key string) (stop func(), err error) {
+	return etcdx.WatchKey(repo, key, func(value []byte) error {
+		if value == nil {
+			return r.SetRules(nil)
+		}
+		return r.load(value)
+	})
+}
+
+func (r *Router) load(raw []byte) error {
+	rules := make([]RouteRule, 0)
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return err
+	}
+	return r.SetRules(rules)
+}
+
+// SetRouter 设置灰度路由
+func (s *ServiceClient) SetRouter(router *Router) *ServiceClient {
+	s.router = router
+	return s
+}
+
+// route 按灰度规则过滤实例, 命中规则时在请求头中带上规则名称
+func (s *ServiceClient) route(service string, req RouteRequest, serviceArray []etcdx.ServiceInfo) (string, []etcdx.ServiceInfo) {
+	if s.router == nil {
+		return "", serviceArray
+	}
+	return s.router.Route(service, req, serviceArray)
+}
@@ -0,0 +1,111 @@
+package httpDiscover
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/chenxinqun/ginWarpPkg/datax/etcdx"
+
+	"go.uber.org/zap"
+)
+
+func TestRouteRuleMatch(t *testing.T) {
+	header := func(kv ...string) http.Header {
+		h := http.Header{}
+		for i := 0; i+1 < len(kv); i += 2 {
+			h.Set(kv[i], kv[i+1])
+		}
+		return h
+	}
+	rule := RouteRule{Name: "user-v2", Version: "v2", Tenants: []int64{1001}, Users: []int64{7}, Header: "X-Canary", HeaderValue: "1"}
+	anyValue := RouteRule{Name: "any", Version: "v2", Header: "X-Canary"}
+	all := RouteRule{Name: "all", Version: "v2", Percent: 100}
+	none := RouteRule{Name: "none", Version: "v2", Percent: 0}
+
+	cases := []struct {
+		name string
+		rule RouteRule
+		req  RouteRequest
+		want bool
+	}{
+		{"tenant", rule, RouteRequest{TenantID: 1001}, true},
+		{"user", rule, RouteRequest{UserID: 7}, true},
+		{"header value", rule, RouteRequest{Header: header("X-Canary", "1")}, true},
+		{"header value mismatch", rule, RouteRequest{Header: header("X-Canary", "0")}, false},
+		{"header any value", anyValue, RouteRequest{Header: header("X-Canary", "0")}, true},
+		{"route tag from upstream", rule, RouteRequest{Header: header(RouteTagHeader, "user-v2")}, true},
+		{"other route tag", rule, RouteRequest{Header: header(RouteTagHeader, "other")}, false},
+		{"no match", rule, RouteRequest{UserID: 8, TenantID: 1002}, false},
+		{"percent 100", all, RouteRequest{UserID: 8}, true},
+		{"percent 0", none, RouteRequest{UserID: 8}, false},
+	}
+	for _, c := range cases {
+		if got := c.rule.match(c.req); got != c.want {
+			t.Errorf("%s: match = %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	// 同一个用户总是落在同一边
+	half := RouteRule{Name: "half", Version: "v2", Percent: 50}
+	for id := int64(1); id < 20; id++ {
+		want := half.match(RouteRequest{UserID: id})
+		for i := 0; i < 5; i++ {
+			if half.match(RouteRequest{UserID: id}) != want {
+				t.Fatalf("user %d not sticky", id)
+			}
+		}
+	}
+}
+
+func TestRouterRoute(t *testing.T) {
+	stable := etcdx.ServiceInfo{ID: "stable", Name: "user", ProjectVersion: "v1"}
+	canary := etcdx.ServiceInfo{ID: "canary", Name: "user", ProjectVersion: "v2"}
+	gray := etcdx.ServiceInfo{ID: "gray", Name: "user", ProjectVersion: "v1", Meta: map[string]string{"lane": "gray"}}
+	router, err := NewRouter(zap.NewNop(),
+		RouteRule{Name: "user-v2", Service: "user", Version: "v2", Tenants: []int64{1001}},
+		RouteRule{Name: "gray-lane", Service: "*", Tags: map[string]string{"lane": "gray"}, Users: []int64{7}},
+		RouteRule{Name: "v3", Service: "user", Version: "v3", Tenants: []int64{3003}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(l []etcdx.ServiceInfo) string {
+		ret := ""
+		for _, s := range l {
+			ret += s.ID + ","
+		}
+		return ret
+	}
+	cases := []struct {
+		name    string
+		service string
+		req     RouteRequest
+		list    []etcdx.ServiceInfo
+		tag     string
+		want    string
+	}{
+		{"canary tenant", "user", RouteRequest{TenantID: 1001}, []etcdx.ServiceInfo{stable, canary, gray}, "user-v2", "canary,"},
+		{"tag rule", "user", RouteRequest{UserID: 7}, []etcdx.ServiceInfo{stable, canary, gray}, "gray-lane", "gray,"},
+		{"no match excludes canary", "user", RouteRequest{TenantID: 2002}, []etcdx.ServiceInfo{stable, canary, gray}, "", "stable,"},
+		{"only canary left", "user", RouteRequest{TenantID: 2002}, []etcdx.ServiceInfo{canary}, "", "canary,"},
+		{"matched rule without target", "user", RouteRequest{TenantID: 3003}, []etcdx.ServiceInfo{stable, canary}, "v3", "stable,canary,"},
+		{"rule for other service", "order", RouteRequest{TenantID: 1001}, []etcdx.ServiceInfo{stable, canary}, "", "stable,canary,"},
+	}
+	for _, c := range cases {
+		tag, got := router.Route(c.service, c.req, c.list)
+		if tag != c.tag || ids(got) != c.want {
+			t.Errorf("%s: Route = %s %s, want %s %s", c.name, tag, ids(got), c.tag, c.want)
+		}
+	}
+
+	if err := router.SetRules([]RouteRule{{Name: "bad"}}); err == nil {
+		t.Fatal("invalid rule accepted")
+	}
+	if len(router.Rules()) != 3 {
+		t.Fatal("rules replaced by invalid rules")
+	}
+	if err := router.load([]byte(`[{"name":"v2","version":"v2","percent":100}]`)); err != nil || len(router.Rules()) != 1 {
+		t.Fatalf("load rules: %v, %v", router.Rules(), err)
+	}
+}
@@ -1,16 +1,16 @@
 package httpDiscover
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/chenxinqun/ginWarpPkg/businessCodex"
 	"github.com/chenxinqun/ginWarpPkg/datax/etcdx"
 	"github.com/chenxinqun/ginWarpPkg/errno"
+	"github.com/chenxinqun/ginWarpPkg/httpx/breaker"
 	"github.com/chenxinqun/ginWarpPkg/httpx/httpClient"
 	"github.com/chenxinqun/ginWarpPkg/httpx/mux"
-	"math/rand"
 	"net/http"
-	httpURL "net/url"
+	"strconv"
 	"time"
 
 	"github.com/chenxinqun/ginWarpPkg/convert"
@@ -25,16 +25,61 @@ const (
 	defaultTimeOut = 60
 )
 
+// Resource.Balancer 可选的负载均衡策略
+const (
+	BalancerRandom             = "random"
+	BalancerRoundRobin         = "roundRobin"
+	BalancerWeightedRoundRobin = "weightedRoundRobin"
+	BalancerLeastOutstanding   = "leastOutstanding"
+	BalancerP2C                = "p2c"
+	BalancerConsistentHash     = "consistentHash"
+)
+
+// HashKeyFunc 一致性哈希策略从请求上下文中获取 key, 默认使用 TenantID
+type HashKeyFunc func(ctx context.Context) string
+
+func tenantHashKey(ctx context.Context) string {
+	id, _ := mux.IdentityFromContext(ctx)
+	return fmt.Sprintf("%d", id.TenantID)
+}
+
 type ServiceClient struct {
 	timeout time.Duration
-	// 基于etcd的服务发现与注册接口
+	// 基于etcd的服务发现与注册接口, 灰度路由规则也从这里读取
 	etcdRepo etcdx.Repo
+	// 服务发现, 默认基于 etcdRepo
+	discoverer *discovererHolder
 	// 基于zap的logger
-	logger     *zap.Logger
-	retryCount int
-	retryDelay int
+	logger *zap.Logger
+	// 重试策略和重试预算
+	retry  RetryPolicy
+	budget *retryBudget
 	// 负载均衡器, 只需要传一个进来, 多传无效
 	balancer []etcdx.BalancerFunc
+	// 不为 nil 时使用一致性哈希策略, 忽略 balancer
+	hashKey HashKeyFunc
+	// 每个服务实例正在处理中的请求数
+	inFlight *etcdx.InFlight
+	// 服务实例的主动探测和被动摘除
+	health *healthChecker
+	// 按服务实例熔断, 为 nil 时不熔断
+	breakers *breaker.Group
+	// 灰度路由, 为 nil 时不按规则路由
+	router *Router
+	// stopRouter 停止监听配置中心的灰度路由规则
+	stopRouter func()
+	// 对冲请求, 为 nil 时不发对冲请求
+	hedge       *HedgePolicy
+	hedgeBudget *retryBudget
+	// 每个服务最近成功请求的耗时
+	latency *latencyTracker
+	// 广播时同时请求的实例数和每个实例的超时时间
+	broadcastConcurrency int
+	broadcastTimeout     time.Duration
+	// 流量镜像
+	mirror *mirrorer
+	// 请求的实例协议, 为空时为 http, 见 WithScheme
+	scheme string
 }
 
 type Resource struct {
@@ -47,6 +92,31 @@ type Resource struct {
 	RetryCount int
 	// 重试间隔时间, 单位秒. 会自动加上[10,100)毫秒的随机数, 同时重试时间会指数级增加.
 	RetryDelay int
+	// Retry 重试策略, 不填时根据 RetryCount 和 RetryDelay 生成
+	Retry *RetryPolicy
+	// Breaker 按服务实例熔断的配置, 不填则不熔断
+	Breaker *breaker.Config
+	// Balancer 负载均衡策略, 可选值见 BalancerRandom 等常量, 不填为随机
+	Balancer string
+	// Health 服务实例健康检查配置, 后台定时探测, 并摘除连续失败的实例
+	Health HealthConfig
+	// RouteRulesKey 灰度路由规则在配置中心的 key, 不填则不启用灰度路由, 见 Router.Watch
+	RouteRulesKey string
+	// BroadcastConcurrency 广播时同时请求的实例数, 默认 10
+	BroadcastConcurrency int
+	// BroadcastTimeout 广播时每个实例的超时时间, 单位秒, 默认与 Timeout 相同
+	BroadcastTimeout int
+	// Discoverer 服务发现方式, 不填时使用 etcd, 见 NewStaticDiscoverer, NewDNSDiscoverer, NewMemoryDiscoverer
+	Discoverer Discoverer
+	// Mirror 流量镜像策略, 不填则不镜像, 见 MirrorPolicy
+	Mirror []MirrorPolicy
+}
+
+var defaultClient *ServiceClient
+
+// Default 第一个通过 New 创建的客户端
+func Default() *ServiceClient {
+	return defaultClient
 }
 
 func New(rs ...Resource) *ServiceClient {
@@ -66,169 +136,276 @@ func New(rs ...Resource) *ServiceClient {
 	}
 	timeout := time.Duration(r.Timeout) * time.Second
 	var ret = new(ServiceClient)
+	// 第一次初始化设置为默认客户端
+	defer func() {
+		if defaultClient == nil {
+			defaultClient = ret
+		}
+	}()
 	ret.logger = loggerx.Default()
 	ret.etcdRepo = etcdx.Default()
+	discoverer := r.Discoverer
+	if discoverer == nil && ret.etcdRepo != nil {
+		discoverer = NewEtcdDiscoverer(ret.etcdRepo)
+	}
+	ret.discoverer = &discovererHolder{d: discoverer}
 	ret.timeout = timeout
-	ret.retryCount = r.RetryCount
-	ret.retryDelay = r.RetryDelay
+	if r.Retry != nil {
+		ret.retry = r.Retry.normalize()
+	} else {
+		ret.retry = RetryPolicy{
+			MaxAttempts: r.RetryCount + 1,
+			Backoff:     time.Duration(r.RetryDelay) * time.Second,
+		}.normalize()
+	}
+	ret.budget = newRetryBudget(ret.retry.BudgetRatio, ret.retry.MinRetries)
+	if r.Breaker != nil {
+		ret.breakers = breaker.NewGroup(*r.Breaker)
+	}
+	ret.inFlight = etcdx.NewInFlight()
+	ret.latency = newLatencyTracker()
+	ret.broadcastConcurrency, ret.broadcastTimeout = broadcastDefaults(&r)
+	ret.mirror = new(mirrorer)
+	if err := ret.SetMirror(r.Mirror...); err != nil {
+		ret.logger.Error("流量镜像策略不合法", zap.Error(err))
+	}
+	ret.health = newHealthChecker(r.Health, ret.logger, ret.checkHealth)
+	if ret.breakers != nil {
+		// 实例下线后删除对应的熔断器, 避免熔断器和指标随实例变更一直增长
+		ret.health.onRemove = ret.breakers.Remove
+	}
+	go ret.health.run(ret.discoverer.load)
+	switch r.Balancer {
+	case BalancerRoundRobin:
+		ret.SetBalancer(etcdx.RoundRobinPolicy())
+	case BalancerWeightedRoundRobin:
+		ret.SetBalancer(etcdx.WeightedRoundRobinPolicy())
+	case BalancerLeastOutstanding:
+		ret.SetBalancer(etcdx.LeastOutstandingPolicy(ret.inFlight))
+	case BalancerP2C:
+		ret.SetBalancer(etcdx.P2CPolicy(ret.inFlight))
+	case BalancerConsistentHash:
+		ret.SetHashKey(tenantHashKey)
+	}
+	if r.RouteRulesKey != "" && ret.etcdRepo != nil {
+		router, _ := NewRouter(ret.logger)
+		stop, err := router.Watch(ret.etcdRepo, r.RouteRulesKey)
+		if err != nil {
+			ret.logger.Error("读取灰度路由规则失败", zap.String("key", r.RouteRulesKey), zap.Error(err))
+		}
+		ret.router, ret.stopRouter = router, stop
+	}
 
 	return ret
 }
 
-func shouldRetry(httpCode int) bool {
-	switch httpCode {
-	case
-		// 请求超时则重试
-		http.StatusRequestTimeout:
+// SetBalancer 设置负载均衡策略, 需要实例请求数的策略使用 InFlight() 创建, 如 etcdx.P2CPolicy(s.InFlight())
+func (s *ServiceClient) SetBalancer(balancer etcdx.BalancerFunc) *ServiceClient {
+	s.balancer = []etcdx.BalancerFunc{balancer}
+	s.hashKey = nil
+	return s
+}
+
+// SetHashKey 使用一致性哈希策略, 相同 key 的请求落到同一个实例上
+func (s *ServiceClient) SetHashKey(hashKey HashKeyFunc) *ServiceClient {
+	s.hashKey = hashKey
+	return s
+}
 
-		return true
+// InFlight 每个服务实例正在处理中的请求数, 由实际发出的请求维护
+func (s *ServiceClient) InFlight() *etcdx.InFlight {
+	return s.inFlight
+}
 
-	default:
-		return false
+// instanceKey 服务实例的熔断 key
+func instanceKey(service etcdx.ServiceInfo) string {
+	if service.ID != "" {
+		return service.Name + "/" + service.ID
 	}
+	return service.Name + "/" + service.Url()
 }
 
-func (s *ServiceClient) serviceHealth(service etcdx.ServiceInfo) bool {
-	url := service.Url()
-	healthUrl := fmt.Sprintf("%s%s", url, service.HealthPath)
-	// 快速健康检查
-	ttl := service.TTL / 2
-	if ttl < 1 {
-		ttl = 1
-	} else if ttl > 5 {
-		ttl = 5
-	}
-	healthResp, httpCode, e := httpClient.GetJson(healthUrl, httpURL.Values{}, httpClient.WithTTL(time.Duration(ttl)*time.Second))
-	if httpCode != http.StatusOK || e != nil {
-		s.logger.Error("健康检查请求", zap.Error(e),
-			zap.String("name", service.Name),
-			zap.String("url", healthUrl),
-			zap.Int("status", httpCode))
-		return false
-	}
-	respData := &businessCodex.Response{}
-	e = json.Unmarshal(healthResp, &respData)
-	if e != nil {
-		s.logger.Error("健康检查返回值解析错误", zap.Error(e),
-			zap.String("name", service.Name),
-			zap.String("url", healthUrl),
-			zap.Int("status", httpCode),
-			zap.ByteString("response", healthResp),
-		)
-		return false
-	}
-	healthData := respData.Data.(map[string]interface{})
-	var health bool
-	for k, v := range service.HealthVerdict {
-		hv, ok := healthData[k]
-		if !ok {
-			continue
+type RetryVerify func(body []byte) (shouldRetry bool)
+
+// call 一次服务调用的请求参数
+type call struct {
+	ctx         context.Context
+	serviceName string
+	urlPath     string
+	attempt     int
+	requestFunc httpClient.RequestFunc
+	requestData interface{}
+	handlers    []httpClient.OptionHandler
+	// 镜像请求, 不计入耗时统计
+	mirror bool
+}
+
+// send 向一个实例发起请求, 并记录请求数, 健康状态, 熔断和耗时. 调用方取消或超时,
+// 以及对冲请求已经拿到结果而被取消时, 不计入健康状态和熔断的失败
+func (s *ServiceClient) send(ctx context.Context, c *call, service etcdx.ServiceInfo, brk *breaker.Breaker, hedged bool) (body []byte, httpCode int, err error) {
+	// 合成请求的完整路径
+	url := service.Url() + c.urlPath
+	options := make([]httpClient.OptionHandler, 0, len(c.handlers)+3)
+	options = append(options, c.handlers...)
+	options = append(options, httpClient.WithContext(ctx), httpClient.WithHeader(RetryAttemptHeader, strconv.Itoa(c.attempt)))
+	if hedged {
+		options = append(options, httpClient.WithHeader(HedgeHeader, "1"))
+	}
+	if c.mirror {
+		options = append(options, httpClient.WithHeader(MirrorHeader, "1"))
+	}
+	// 发起请求, 每次请求都会在链路中记录一个 dialog
+	ts := time.Now()
+	done := s.inFlight.Start(service)
+	body, httpCode, err = c.requestFunc(url, c.requestData, options...)
+	done()
+	cost := time.Since(ts)
+	if ctx.Err() != nil {
+		if brk != nil {
+			brk.Done(true, 0)
 		}
-		check, ok := hv.(string)
-		if !ok {
-			continue
+		return
+	}
+	s.health.report(service, httpCode, err)
+	if brk != nil {
+		brk.Done(err == nil || (httpCode > 0 && httpCode < http.StatusInternalServerError), cost)
+	}
+	if err == nil && !c.mirror {
+		s.latency.observe(c.serviceName, cost)
+	}
+	s.logger.Info("请求服务", zap.String("service name", c.serviceName), zap.String("url", url), zap.Int("attempt", c.attempt),
+		zap.Bool("hedged", hedged), zap.Bool("mirrored", c.mirror), zap.Int("status", httpCode), zap.Error(err))
+	return
+}
+
+// pick 从 idx 开始挑选一个没有被熔断的实例, 所有实例都被熔断时返回 false
+func (s *ServiceClient) pick(serviceArray []etcdx.ServiceInfo, idx *int, rejected **breaker.Breaker, err *error) (etcdx.ServiceInfo, *breaker.Breaker, bool) {
+	for i := 0; i < len(serviceArray); i++ {
+		service := serviceArray[*idx%len(serviceArray)]
+		if s.breakers == nil {
+			return service, nil, true
 		}
-		health = check == v
-		if health {
-			break
+		brk := s.breakers.Get(instanceKey(service))
+		if e := brk.Allow(); e != nil {
+			*rejected, *err = brk, e
+			*idx++
+			continue
 		}
+		return service, brk, true
 	}
-	if !health {
-		s.logger.Error("健康检查返回状态为不健康",
-			zap.String("name", service.Name),
-			zap.String("url", healthUrl),
-			zap.Int("status", httpCode),
-			zap.ByteString("response", healthResp),
-		)
-		return false
-	}
-	return true
+	return etcdx.ServiceInfo{}, nil, false
 }
 
-type RetryVerify func(body []byte) (shouldRetry bool)
+// requestOptions 请求下游服务的公共参数, 透传请求头, trace 和身份信息
+func (s *ServiceClient) requestOptions(ctx context.Context, header http.Header) []httpClient.OptionHandler {
+	handlers := make([]httpClient.OptionHandler, 0)
+	for k, _ := range header {
+		handlers = append(handlers, httpClient.WithHeader(k, header.Get(k)))
+	}
+	handlers = append(handlers, httpClient.WithLogger(s.logger), httpClient.WithTTL(s.timeout), httpClient.WithTrace(mux.TraceFromContext(ctx)))
+	if identity, ok := mux.IdentityFromContext(ctx); ok {
+		handlers = append(handlers, []httpClient.OptionHandler{
+			httpClient.WithHeader(mux.UserID, fmt.Sprintf("%d", identity.UserID)),
+			httpClient.WithHeader(mux.UserName, fmt.Sprintf("%s", identity.UserName)),
+			httpClient.WithHeader(mux.RoleType, fmt.Sprintf("%d", identity.RoleType)),
+			httpClient.WithHeader(mux.TenantID, fmt.Sprintf("%d", identity.TenantID)),
+			httpClient.WithHeader(mux.IsAdmin, fmt.Sprintf("%v", identity.IsAdmin)),
+		}...)
+	}
+	return handlers
+}
 
-func (s *ServiceClient) retryRequest(ctx mux.Context, serviceName string, urlPath, scheme string, requestFunc httpClient.RequestFunc,
+// retryRequest 按负载均衡, 灰度路由, 健康状态挑选实例发起请求, 并按重试策略重试.
+// ctx 中的 trace, 身份信息(mux.NewIdentityContext)和请求头(mux.NewHeaderContext)会传递给下游服务.
+func (s *ServiceClient) retryRequest(ctx context.Context, serviceName string, urlPath, scheme, method string, requestFunc httpClient.RequestFunc,
 	requestData interface{}, retryVerify ...RetryVerify) (body []byte, httpCode int, err error) {
+	var rejected *breaker.Breaker
 	defer func() {
+		// 等待重试时调用方取消或者超时, 直接返回 ctx 的错误
+		if e := ctx.Err(); e != nil && err == e {
+			return
+		}
+		// 所有实例都被熔断时, 使用降级处理
+		if httpCode == 0 && rejected != nil {
+			if body, err = rejected.Fallback(err); err == nil {
+				httpCode = http.StatusOK
+			}
+			return
+		}
 		if httpCode == 0 {
-			err = errno.Errorf("%s 服务找不到, 或者请求 %s 没有响应", serviceName, urlPath)
+			err = errno.Errorf("%s 服务找不到, 或者请求 %s 没有响应: %v", serviceName, urlPath, err)
 		}
 	}()
-	if scheme == "" {
-		scheme = "http"
+	scheme = s.schemeOrDefault(scheme)
+	balancer := s.balancer
+	if s.hashKey != nil {
+		balancer = []etcdx.BalancerFunc{etcdx.ConsistentHashPolicy(s.hashKey(ctx))}
 	}
-	// 获得一个随机打乱了顺序的服务列表
-	serviceArray := s.etcdRepo.GetServiceArray(etcdx.ServiceInfo{Name: serviceName, Scheme: scheme}, s.balancer...)
-	// 如果没拿到服务列表, 重新发现一次服务, 再去拿
-	if len(serviceArray) == 0 {
-		_ = s.etcdRepo.Discover(s.etcdRepo.GetRepo().Service.Val)
-		serviceArray = s.etcdRepo.GetServiceArray(etcdx.ServiceInfo{Name: serviceName, Scheme: scheme}, s.balancer...)
+	// 获得一个按负载均衡策略排好序的服务列表, 没拿到时会重新发现一次服务
+	var serviceArray []etcdx.ServiceInfo
+	if l := s.registers(serviceName, scheme); len(l) > 0 {
+		serviceArray = etcdx.ServiceArray(l, balancer...)
 	}
-	handlers := make([]httpClient.OptionHandler, 0)
-	header := ctx.GinContext().Request.Header
-	for k, _ := range header {
-		handlers = append(handlers, httpClient.WithHeader(k, header.Get(k)))
+	header := mux.HeaderFromContext(ctx)
+	if header == nil {
+		header = make(http.Header)
+	}
+	// 镜像的目标实例不接收正常流量
+	mirror, serviceArray := s.mirror.match(serviceName, method, serviceArray)
+	identity, _ := mux.IdentityFromContext(ctx)
+	routeTag, serviceArray := s.route(serviceName, RouteRequest{UserID: identity.UserID, TenantID: identity.TenantID, Header: header}, serviceArray)
+	s.health.watch(serviceName, scheme)
+	serviceArray = s.filterAvailable(serviceArray)
+	handlers := s.requestOptions(ctx, header)
+	if routeTag != "" {
+		handlers = append(handlers, httpClient.WithHeader(RouteTagHeader, routeTag))
 	}
 
-	handlers = append(handlers, []httpClient.OptionHandler{
-		httpClient.WithLogger(s.logger), httpClient.WithTTL(s.timeout), httpClient.WithTrace(ctx.Trace()),
-		httpClient.WithHeader(mux.UserID, fmt.Sprintf("%d", ctx.UserID())),
-		httpClient.WithHeader(mux.UserName, fmt.Sprintf("%s", ctx.UserName())),
-		httpClient.WithHeader(mux.RoleType, fmt.Sprintf("%d", ctx.RoleType())),
-		httpClient.WithHeader(mux.TenantID, fmt.Sprintf("%d", ctx.TenantID())),
-		httpClient.WithHeader(mux.IsAdmin, fmt.Sprintf("%v", ctx.IsAdmin())),
-	}...)
-
-	// 遍历这个服务, 先做健康检查再请求, 如果一遍过就跳出循环, 如果一遍不过, 就重试
-	for _, service := range serviceArray {
-		// 挑选一个健康的服务
-		if !s.serviceHealth(service) {
-			// 删除不可用的服务
-			s.etcdRepo.GetRepo().DelServiceList(service.Name, service.ID)
-			continue
-		}
-		// 合成请求的完整路径
-		url := service.Url() + urlPath
-		// 发起请求
-		body, httpCode, err = requestFunc(url, requestData, handlers...)
-		loggerx.Default().Info("请求服务", zap.String("service name", serviceName), zap.String("url", url), zap.String("request func", fmt.Sprintf("%T", requestFunc)))
-		// 进入重试模式
-		for k := 0; k < s.retryCount; k++ {
-			var needRetry bool
-			// 进行通用校验, 校验状态码
-			needRetry = shouldRetry(httpCode)
-			// 指数级重试时间
-			retryTime := time.Second * time.Duration(s.retryDelay*(k+1))
-			rand.Seed(time.Now().UnixNano())
-			// 增加10-100毫秒的重试随机数
-			randInt := rand.Intn(100)
-			if randInt < 10 {
-				randInt = 10
+	if mirror != nil {
+		mc := &call{ctx: ctx, serviceName: serviceName, urlPath: urlPath, requestFunc: requestFunc, requestData: requestData, handlers: handlers}
+		defer func() {
+			s.runMirror(mirror, mc, body, httpCode, err)
+		}()
+	}
+
+	idempotent := s.retry.idempotent(method, header)
+	s.budget.deposit()
+	idx := 0
+	for attempt := 1; attempt <= s.retry.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			// 调用方已经取消或者超时
+			if ctx.Err() != nil {
+				break
 			}
-			retryTime += time.Millisecond * time.Duration(randInt)
-			// 如果从验证码判断, 需要重试
-			if needRetry {
-				time.Sleep(retryTime)
-				continue
-			} else {
-				// 如果通过状态码判断不需要重试, 则进入body验证, 验证返回值
-				for _, retry := range retryVerify {
-					needRetry = retry(body)
-					if needRetry {
-						break
-					}
-				}
-				// 如果专用验证判断, 需要重试, 则走这里
-				if needRetry {
-					time.Sleep(retryTime)
-					continue
-				} else {
-					// 不需要重试, 直接打断循环
-					break
-				}
+			if !s.retry.retryable(idempotent, httpCode, err, body, retryVerify) {
+				break
+			}
+			if !s.budget.withdraw() {
+				s.logger.Warn("重试预算不足, 不再重试", zap.String("service name", serviceName), zap.String("path", urlPath))
+				break
+			}
+			if err = wait(ctx, s.retry.backoff(attempt-1)); err != nil {
+				return nil, 0, err
+			}
+			// 换下一个实例重试
+			if !s.retry.NoFailover {
+				idx++
+			}
+		}
+		c := &call{ctx: ctx, serviceName: serviceName, urlPath: urlPath, attempt: attempt, requestFunc: requestFunc, requestData: requestData, handlers: handlers}
+		// 对冲请求, 第一个请求慢的时候向其它实例再发一次, 取最先成功的结果
+		if s.hedge != nil && s.hedge.allow(method) {
+			var ok bool
+			if body, httpCode, err, ok = s.hedgedSend(c, serviceArray, &idx, &rejected); !ok {
+				break
 			}
+			continue
+		}
+		service, brk, ok := s.pick(serviceArray, &idx, &rejected, &err)
+		if !ok {
+			break
 		}
-		return body, httpCode, err
+		body, httpCode, err = s.send(ctx, c, service, brk, false)
 	}
 	return body, httpCode, err
 }
@@ -239,17 +416,8 @@ func (s *ServiceClient) GetJson(ctx mux.Context, serviceName string, urlPath str
 	if err != nil {
 		return code, err
 	}
-	body, code, err := s.retryRequest(ctx, serviceName, urlPath, "", httpClient.GetJson, urlParams)
-	if err == nil {
-		if result != nil && body != nil {
-			r := NewResult(result)
-			if r.Code != 0 {
-				return code, r
-			}
-			return code, json.Unmarshal(body, r)
-		}
-	}
-	return code, err
+	body, code, err := s.retryRequest(mux.WithRequestValues(context.Background(), ctx), serviceName, urlPath, "", http.MethodGet, httpClient.GetJson, urlParams)
+	return code, parseResult(body, err, result)
 }
 
 func (s *ServiceClient) PostJson(ctx mux.Context, serviceName string, urlPath string, params interface{}, result interface{}) (code int, err error) {
@@ -258,17 +426,8 @@ func (s *ServiceClient) PostJson(ctx mux.Context, serviceName string, urlPath st
 	if err != nil {
 		return code, err
 	}
-	body, code, err := s.retryRequest(ctx, serviceName, urlPath, "", httpClient.PostJSON, jsonBs)
-	if err == nil {
-		if result != nil && body != nil {
-			r := NewResult(result)
-			if r.Code != 0 {
-				return code, r
-			}
-			return code, json.Unmarshal(body, r)
-		}
-	}
-	return code, err
+	body, code, err := s.retryRequest(mux.WithRequestValues(context.Background(), ctx), serviceName, urlPath, "", http.MethodPost, httpClient.PostJSON, jsonBs)
+	return code, parseResult(body, err, result)
 }
 
 func (s *ServiceClient) PutJson(ctx mux.Context, serviceName string, urlPath string, params interface{}, result interface{}) (code int, err error) {
@@ -277,17 +436,8 @@ func (s *ServiceClient) PutJson(ctx mux.Context, serviceName string, urlPath str
 	if err != nil {
 		return code, err
 	}
-	body, code, err := s.retryRequest(ctx, serviceName, urlPath, "", httpClient.PutJSON, jsonBs)
-	if err == nil {
-		if result != nil && body != nil {
-			r := NewResult(result)
-			if r.Code != 0 {
-				return code, r
-			}
-			return code, json.Unmarshal(body, r)
-		}
-	}
-	return code, err
+	body, code, err := s.retryRequest(mux.WithRequestValues(context.Background(), ctx), serviceName, urlPath, "", http.MethodPut, httpClient.PutJSON, jsonBs)
+	return code, parseResult(body, err, result)
 }
 
 func (s *ServiceClient) DeleteJson(ctx mux.Context, serviceName string, urlPath string, params interface{}, result interface{}) (code int, err error) {
@@ -296,17 +446,8 @@ func (s *ServiceClient) DeleteJson(ctx mux.Context, serviceName string, urlPath
 	if err != nil {
 		return code, err
 	}
-	body, code, err := s.retryRequest(ctx, serviceName, urlPath, "", httpClient.DeleteJson, urlParams)
-	if err == nil {
-		if result != nil && body != nil {
-			r := NewResult(result)
-			if r.Code != 0 {
-				return code, r
-			}
-			return code, json.Unmarshal(body, r)
-		}
-	}
-	return code, err
+	body, code, err := s.retryRequest(mux.WithRequestValues(context.Background(), ctx), serviceName, urlPath, "", http.MethodDelete, httpClient.DeleteJson, urlParams)
+	return code, parseResult(body, err, result)
 }
 
 func (s *ServiceClient) PatchJson(ctx mux.Context, serviceName string, urlPath string, params interface{}, result interface{}) (code int, err error) {
@@ -315,17 +456,23 @@ func (s *ServiceClient) PatchJson(ctx mux.Context, serviceName string, urlPath s
 	if err != nil {
 		return code, err
 	}
-	body, code, err := s.retryRequest(ctx, serviceName, urlPath, "", httpClient.PatchJSON, jsonBs)
-	if err == nil {
-		if result != nil && body != nil {
-			r := NewResult(result)
-			if r.Code != 0 {
-				return code, r
-			}
-			return code, json.Unmarshal(body, r)
-		}
+	body, code, err := s.retryRequest(mux.WithRequestValues(context.Background(), ctx), serviceName, urlPath, "", http.MethodPatch, httpClient.PatchJSON, jsonBs)
+	return code, parseResult(body, err, result)
+}
+
+// parseResult 解析 Result 格式的返回值, 业务码不是成功码时返回 *Result
+func parseResult(body []byte, err error, result interface{}) error {
+	if err != nil || result == nil || body == nil {
+		return err
+	}
+	r := NewResult(result)
+	if err = json.Unmarshal(body, r); err != nil {
+		return err
+	}
+	if !httpClient.IsSucceedCode(r.Code) {
+		return r
 	}
-	return code, err
+	return nil
 }
 
 func NewResult(data interface{}) *Result {
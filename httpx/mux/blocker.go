@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"runtime/debug"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -17,8 +18,27 @@ import (
 
 var (
 	WithoutTracePaths map[string]bool
+	// withoutBodyCaptureRoutes 这些路由不预先读取请求体, 通过 WithoutBodyCapture 添加
+	withoutBodyCaptureRoutes   = map[string]bool{}
+	withoutBodyCaptureRoutesMu sync.RWMutex
 )
 
+// WithoutBodyCapture 这些路由不预先读取请求体, 请求体保持流式, 链路中也不记录请求体.
+// route 为注册时的完整路由, 即 gin 的 FullPath, 如 /api/*gatewayPath. 可以在服务运行时调用.
+func WithoutBodyCapture(routes ...string) {
+	withoutBodyCaptureRoutesMu.Lock()
+	defer withoutBodyCaptureRoutesMu.Unlock()
+	for _, route := range routes {
+		withoutBodyCaptureRoutes[route] = true
+	}
+}
+
+func skipBodyCapture(route string) bool {
+	withoutBodyCaptureRoutesMu.RLock()
+	defer withoutBodyCaptureRoutesMu.RUnlock()
+	return withoutBodyCaptureRoutes[route]
+}
+
 func init() {
 	// withoutLogPaths 这些请求，默认不记录链路追踪
 	WithoutTracePaths = map[string]bool{
@@ -204,14 +224,34 @@ func AfterContext(ctx *gin.Context, ictx Context, r Resource, opt Option, ts tim
 	)
 }
 
+var registerTraceExporterOnce sync.Once
+
+// registerTraceExporter trace.Start 创建的后台链路, 结束时和请求链路使用同一个 logger 和指标回调输出.
+// 只在第一次调用 InitContext 时注册, 之后的调用不会覆盖
+func registerTraceExporter(r Resource, opt Option) {
+	registerTraceExporterOnce.Do(func() {
+		if r.Logger != nil {
+			trace.RegisterExporter(trace.ExporterLogger, trace.NewLogExporter(r.Logger))
+		}
+		if record := opt.RecordMetrics; record != nil {
+			trace.RegisterExporter("metrics", func(t *trace.Trace, err error) {
+				record("BACKGROUND", t.Name, t.Success, 0, 0, t.CostSeconds, t.TraceID)
+			})
+		}
+	})
+}
+
 func InitContext(r Resource, opt Option) gin.HandlerFunc {
+	registerTraceExporter(r, opt)
 	return func(ctx *gin.Context) {
 		ts := time.Now()
 
 		ictx := NewContext(ctx)
 		defer ReleaseContext(ictx)
 
-		ictx.init()
+		if !skipBodyCapture(ctx.FullPath()) {
+			ictx.init()
+		}
 
 		// 不在这个列表中的URL, 开启链路追踪
 		if !WithoutTracePaths[ctx.Request.URL.Path] {
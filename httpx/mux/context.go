@@ -621,11 +621,12 @@ func (c *context) GinContext() *gin.Context {
 	return c.ctx
 }
 
-// RequestContext (包装 Trace ) 获取一个用来向别的服务发起请求的 context (当client关闭后，会自动canceled).
+// RequestContext (包装 Trace, 身份信息和请求头) 获取一个用来向别的服务发起请求的 context (当client关闭后，会自动canceled).
 // 可以传一个数字进来, 作为timeout的值, 单位是秒. 注意只能传0个或一个, 不要传多了
 func (c *context) RequestContext(timeout ...int) *StdContext {
 	ret := GetRequestContext(timeout...)
 	ret.Trace = c.Trace()
+	ret.Context = WithRequestValues(ret.Context, c)
 	return ret
 }
 
@@ -634,6 +635,27 @@ func (c *context) ResponseWriter() gin.ResponseWriter {
 	return c.ctx.Writer
 }
 
+// TraceFromContext 从 context 中获取 trace, 兼容直接传入 StdContext 但没有放入 context value 的情况
+func TraceFromContext(ctx stdctx.Context) Trace {
+	if ctx == nil {
+		return nil
+	}
+	if t := trace.FromContext(ctx); t != nil {
+		return t
+	}
+	switch c := ctx.(type) {
+	case *StdContext:
+		if c != nil {
+			return c.Trace
+		}
+	case StdContext:
+		return c.Trace
+	case interface{ Trace() Trace }:
+		return c.Trace()
+	}
+	return nil
+}
+
 func GetRequestContext(timeout ...int) *StdContext {
 	var (
 		tmout int
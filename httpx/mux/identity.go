@@ -0,0 +1,72 @@
+package mux
+
+import (
+	stdctx "context"
+	"net/http"
+
+	"github.com/chenxinqun/ginWarpPkg/httpx/trace"
+)
+
+type identityKey struct{}
+
+type headerKey struct{}
+
+// Identity 请求的身份信息, 通过 context 传递给不依赖 mux.Context 的调用方, 如 kafka 消费者, 定时任务等
+type Identity struct {
+	UserID   int64
+	UserName string
+	TenantID int64
+	RoleType int32
+	IsAdmin  bool
+}
+
+// NewIdentityContext 把身份信息放入 context
+func NewIdentityContext(ctx stdctx.Context, id Identity) stdctx.Context {
+	return stdctx.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext 从 context 中获取身份信息
+func IdentityFromContext(ctx stdctx.Context) (Identity, bool) {
+	if ctx == nil {
+		return Identity{}, false
+	}
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// NewHeaderContext 把需要向下游透传的请求头放入 context
+func NewHeaderContext(ctx stdctx.Context, header http.Header) stdctx.Context {
+	return stdctx.WithValue(ctx, headerKey{}, header)
+}
+
+// HeaderFromContext 从 context 中获取需要向下游透传的请求头
+func HeaderFromContext(ctx stdctx.Context) http.Header {
+	if ctx == nil {
+		return nil
+	}
+	header, _ := ctx.Value(headerKey{}).(http.Header)
+	return header
+}
+
+// IdentityOf 获取请求的身份信息
+func IdentityOf(c Context) Identity {
+	return Identity{
+		UserID:   c.UserID(),
+		UserName: c.UserName(),
+		TenantID: c.TenantID(),
+		RoleType: c.RoleType(),
+		IsAdmin:  c.IsAdmin(),
+	}
+}
+
+// WithRequestValues 把请求的 trace, 身份信息和请求头放入 ctx 中
+func WithRequestValues(ctx stdctx.Context, c Context) stdctx.Context {
+	if t := c.Trace(); t != nil {
+		ctx = trace.NewContext(ctx, t)
+	}
+	ctx = NewIdentityContext(ctx, IdentityOf(c))
+	if req := c.Request(); req != nil {
+		ctx = NewHeaderContext(ctx, req.Header)
+	}
+	return ctx
+}
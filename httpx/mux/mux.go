@@ -46,6 +46,8 @@ func (m *Mux) Group(relativePath string, handlers ...HandlerFunc) RouterGroup {
 // RouterGroup 包装gin的RouterGroup
 type RouterGroup interface {
 	Group(string, ...HandlerFunc) RouterGroup
+	// BasePath 路由组的完整路径
+	BasePath() string
 	IRoutes
 }
 
@@ -72,6 +74,10 @@ func (r *router) Group(relativePath string, handlers ...HandlerFunc) RouterGroup
 	return &router{group: group}
 }
 
+func (r *router) BasePath() string {
+	return r.group.BasePath()
+}
+
 func (r *router) Any(relativePath string, handlers ...HandlerFunc) {
 	r.group.Any(relativePath, WrapHandlers(handlers...)...)
 }
@@ -2,6 +2,11 @@ package mux
 
 import (
 	"fmt"
+	"strings"
+
+	"github.com/chenxinqun/ginWarpPkg/loggerx"
+
+	"go.uber.org/zap"
 )
 
 const MaxBurstSize = 100000
@@ -21,6 +26,11 @@ type Option struct {
 // OnPanicNotify 发生panic时通知用
 type OnPanicNotify func(ctx Context, err interface{}, stackInfo string)
 
+// AlarmSender 告警发送, alarm 包中的实现都可以直接使用
+type AlarmSender interface {
+	Send(subject, body string) error
+}
+
 // RecordMetrics 记录prometheus指标用
 // 如果使用AliasForRecordMetrics配置了别名，uri将被替换为别名。
 type RecordMetrics func(method, uri string, success bool, httpCode, businessCode int, costSeconds float64, traceID string)
@@ -46,6 +56,32 @@ func WithDisablePrometheus() OptionHandler {
 	}
 }
 
+// WithPanicNotify 设置发生panic时的通知回调
+func WithPanicNotify(notify OnPanicNotify) OptionHandler {
+	return func(opt *Option) {
+		opt.PanicNotify = notify
+	}
+}
+
+// WithPanicAlarm 发生panic时通过 sender 发送告警, 建议使用 alarm.NewThrottle 包装避免告警刷屏
+func WithPanicAlarm(title string, sender AlarmSender) OptionHandler {
+	return func(opt *Option) {
+		opt.PanicNotify = func(ctx Context, err interface{}, stackInfo string) {
+			var traceID string
+			if t := ctx.Trace(); t != nil {
+				traceID = t.ID()
+			}
+			body := fmt.Sprintf("trace_id: %s<br/>request: %s %s<br/>panic: %+v<br/>stack:<br/>%s",
+				traceID, ctx.Method(), ctx.URI(), err, strings.ReplaceAll(stackInfo, "\n", "<br/>"))
+			go func() {
+				if e := sender.Send(title, body); e != nil && loggerx.Default() != nil {
+					loggerx.Default().Error("发送panic告警失败", zap.String("title", title), zap.String("trace_id", traceID), zap.Error(e))
+				}
+			}()
+		}
+	}
+}
+
 // WithRecordMetrics 设置记录prometheus记录指标回调
 func WithRecordMetrics(record RecordMetrics) OptionHandler {
 	return func(opt *Option) {
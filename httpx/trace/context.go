@@ -0,0 +1,123 @@
+package trace
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/chenxinqun/ginWarpPkg/loggerx"
+
+	"go.uber.org/zap"
+)
+
+type contextKey struct{}
+
+// NewContext 返回一个携带 trace 的 context, 数据库, 消息队列, 后台协程等只需要拿到这个 context 就能找到 trace
+func NewContext(ctx context.Context, t T) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if t == nil {
+		return ctx
+	}
+	if x, ok := t.(*Trace); ok && x == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext 从 context 中获取 trace, 没有则返回 nil
+func FromContext(ctx context.Context) T {
+	if ctx == nil {
+		return nil
+	}
+	t, _ := ctx.Value(contextKey{}).(T)
+	return t
+}
+
+// Exporter 链路结束时的输出, 如打印日志, 记录指标等
+type Exporter func(t *Trace, err error)
+
+const (
+	// ExporterLogger 默认的日志输出, 使用 loggerx.Default() 打印链路
+	ExporterLogger = "logger"
+)
+
+var (
+	exportersMu sync.RWMutex
+	exporters   = map[string]Exporter{
+		ExporterLogger: logExporter,
+	}
+)
+
+// RegisterExporter 注册链路结束时的输出, 同名的会被覆盖, e 为 nil 时删除
+func RegisterExporter(name string, e Exporter) {
+	exportersMu.Lock()
+	defer exportersMu.Unlock()
+	if e == nil {
+		delete(exporters, name)
+		return
+	}
+	exporters[name] = e
+}
+
+func logExporter(t *Trace, err error) {
+	exportLog(loggerx.Default(), t, err)
+}
+
+// NewLogExporter 使用指定的 logger 打印链路, 格式与默认的日志输出相同
+func NewLogExporter(logger *zap.Logger) Exporter {
+	return func(t *Trace, err error) {
+		exportLog(logger, t, err)
+	}
+}
+
+func exportLog(logger *zap.Logger, t *Trace, err error) {
+	if logger == nil {
+		return
+	}
+	logger.Info("background-interceptor",
+		zap.String("name", t.Name),
+		zap.Bool("success", t.Success),
+		zap.Float64("cost_seconds", t.CostSeconds),
+		zap.String("trace_id", t.TraceID),
+		zap.Any("trace_info", t),
+		zap.Error(err),
+	)
+}
+
+// Start 为定时任务, 消息消费, 后台协程等不经过 HTTP 的工作创建一个根链路, 结束时调用 Finish 输出.
+//
+//	t := trace.Start("cron:clean-cache")
+//	ctx := trace.NewContext(context.Background(), t)
+//	defer func() { t.Finish(err) }()
+func Start(name string) *Trace {
+	t := New("")
+	t.Name = name
+	t.startTime = time.Now()
+	return t
+}
+
+// Finish 结束链路, 记录执行结果和耗时, 并交给已注册的 Exporter 输出
+func (t *Trace) Finish(err error) {
+	if t == nil {
+		return
+	}
+	t.mux.Lock()
+	t.Success = err == nil
+	if !t.startTime.IsZero() {
+		t.CostSeconds = time.Since(t.startTime).Seconds()
+	}
+	t.mux.Unlock()
+
+	exportersMu.RLock()
+	list := make([]Exporter, 0, len(exporters))
+	for _, e := range exporters {
+		list = append(list, e)
+	}
+	exportersMu.RUnlock()
+
+	for _, e := range list {
+		e(t, err)
+	}
+}
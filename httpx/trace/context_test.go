@@ -0,0 +1,65 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNewContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != nil {
+		t.Errorf("FromContext() = %v, want nil", got)
+	}
+
+	var nilTrace *Trace
+	if got := FromContext(NewContext(context.Background(), nilTrace)); got != nil {
+		t.Errorf("FromContext() with nil trace = %v, want nil", got)
+	}
+
+	x := New("")
+	ctx, cancel := context.WithCancel(NewContext(context.Background(), x))
+	defer cancel()
+	if got := FromContext(ctx); got != x {
+		t.Errorf("FromContext() = %v, want %v", got, x)
+	}
+}
+
+func TestStartFinish(t *testing.T) {
+	var (
+		got    *Trace
+		gotErr error
+	)
+	RegisterExporter(ExporterLogger, nil)
+	RegisterExporter("test", func(t *Trace, err error) {
+		got, gotErr = t, err
+	})
+	defer func() {
+		RegisterExporter("test", nil)
+		RegisterExporter(ExporterLogger, logExporter)
+	}()
+
+	x := Start("cron:test")
+	x.Finish(errors.New("failed"))
+	if got != x || gotErr == nil {
+		t.Fatalf("exporter got (%v, %v), want (%v, failed)", got, gotErr, x)
+	}
+	if x.Name != "cron:test" || x.Success || x.CostSeconds <= 0 {
+		t.Errorf("Finish() name = %s, success = %v, cost = %v", x.Name, x.Success, x.CostSeconds)
+	}
+}
+
+func TestNewLogExporter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(buf), zap.InfoLevel))
+	x := Start("cron:log")
+	NewLogExporter(logger)(x, nil)
+	if !strings.Contains(buf.String(), "background-interceptor") || !strings.Contains(buf.String(), x.TraceID) {
+		t.Errorf("trace not logged: %s", buf.String())
+	}
+	NewLogExporter(nil)(x, nil)
+}
@@ -1,10 +1,14 @@
 package trace
 
 type Kafka struct {
-	Timestamp   string  `json:"timestamp"`    // 时间，格式：2006-01-02 15:04:05
-	Handle      string  `json:"handle"`       // 操作，CURD
-	Topic       string  `json:"topic"`        // 操作的topic
-	Offset      int64   `json:"offset"`       // offset
-	TTL         float64 `json:"ttl"`          // 超时时长(单位分)
-	CostSeconds float64 `json:"cost_seconds"` // 执行时间(单位秒)
+	Timestamp   string  `json:"timestamp"`             // 时间，格式：2006-01-02 15:04:05
+	Handle      string  `json:"handle"`                // 操作，produce/consume
+	Topic       string  `json:"topic"`                 // 操作的topic
+	Key         string  `json:"key"`                   // 消息的key
+	Partition   int32   `json:"partition"`             // partition
+	Offset      int64   `json:"offset"`                // offset
+	SpanID      string  `json:"span_id"`               // 随消息头传递的调用点ID
+	TTL         float64 `json:"ttl"`                   // 超时时长(单位分)
+	CostSeconds float64 `json:"cost_seconds"`          // 执行时间(单位秒)
+	Message     string  `json:"err_message,omitempty"` // 错误信息
 }
@@ -5,9 +5,14 @@ import (
 	"encoding/hex"
 	"io"
 	"sync"
+	"time"
 )
 
-const Header = "TRACE-ID"
+const (
+	Header = "TRACE-ID"
+	// SpanHeader 跨进程传递时, 标识上游调用点的ID
+	SpanHeader = "TRACE-SPAN-ID"
+)
 
 var _ T = (*Trace)(nil)
 
@@ -26,6 +31,7 @@ type T interface {
 type Trace struct {
 	mux                sync.Mutex
 	TraceID            string    `json:"trace_id"`             // 链路ID
+	Name               string    `json:"name,omitempty"`       // 后台任务名称, 由 Start 创建时设置
 	Request            *Request  `json:"request"`              // 请求信息
 	Response           *Response `json:"response"`             // 返回信息
 	ThirdPartyRequests []*Dialog `json:"third_party_requests"` // 调用第三方接口的信息
@@ -37,6 +43,7 @@ type Trace struct {
 	GRPCs              []*Grpc   `json:"grpc"`                 // 执行的 gRPC 信息
 	Success            bool      `json:"success"`              // 请求结果 true or false
 	CostSeconds        float64   `json:"cost_seconds"`         // 执行时长(单位秒)
+	startTime          time.Time // Start 创建的开始时间, 用于 Finish 计算耗时
 }
 
 // Request 请求信息
@@ -59,11 +66,20 @@ type Response struct {
 	CostSeconds     float64     `json:"cost_seconds"`                // 执行时间(单位秒)
 }
 
+func randomID(size int) string {
+	buf := make([]byte, size)
+	_, _ = io.ReadFull(rand.Reader, buf)
+	return hex.EncodeToString(buf)
+}
+
+// NewSpanID 生成一个调用点ID, 随消息或请求一起传递给下游
+func NewSpanID() string {
+	return randomID(8)
+}
+
 func New(id string) *Trace {
 	if id == "" {
-		buf := make([]byte, 10)
-		_, _ = io.ReadFull(rand.Reader, buf)
-		id = hex.EncodeToString(buf)
+		id = randomID(10)
 	}
 
 	return &Trace{
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsBreakerState metrics for circuit breaker state 仪表盘（Gauge）, 0 关闭, 1 打开, 2 半开
+var metricsBreakerState = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "circuit_breaker_state",
+		Help:      "circuit breaker state, 0 closed, 1 open, 2 half-open",
+	},
+	[]string{"name", "key"},
+)
+
+// metricsBreakerTransitions metrics for circuit breaker state transitions 计数器（Counter）
+var metricsBreakerTransitions = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "circuit_breaker_transitions_total",
+		Help:      "circuit breaker state transitions total",
+	},
+	[]string{"name", "key", "from", "to"},
+)
+
+// metricsBreakerRejected metrics for requests rejected by circuit breaker 计数器（Counter）
+var metricsBreakerRejected = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "circuit_breaker_rejected_total",
+		Help:      "requests rejected by open circuit breaker total",
+	},
+	[]string{"name", "key"},
+)
+
+func init() {
+	prometheus.MustRegister(metricsBreakerState, metricsBreakerTransitions, metricsBreakerRejected)
+}
+
+// RecordBreakerTransition 记录熔断器状态变更, state 为变更后状态的数值
+func RecordBreakerTransition(name, key, from, to string, state int) {
+	metricsBreakerState.With(prometheus.Labels{
+		"name": name,
+		"key":  key,
+	}).Set(float64(state))
+
+	metricsBreakerTransitions.With(prometheus.Labels{
+		"name": name,
+		"key":  key,
+		"from": from,
+		"to":   to,
+	}).Inc()
+}
+
+// RecordBreakerRejected 记录被熔断器拒绝的请求
+func RecordBreakerRejected(name, key string) {
+	metricsBreakerRejected.With(prometheus.Labels{
+		"name": name,
+		"key":  key,
+	}).Inc()
+}
+
+// DeleteBreaker 熔断器删除后删除对应的指标
+func DeleteBreaker(name, key string) {
+	labels := prometheus.Labels{
+		"name": name,
+		"key":  key,
+	}
+	metricsBreakerState.Delete(labels)
+	metricsBreakerRejected.Delete(labels)
+	metricsBreakerTransitions.DeletePartialMatch(labels)
+}
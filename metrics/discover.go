@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsInstanceHealth metrics for discovered service instance health 仪表盘（Gauge）, 1 健康, 0 探测失败, -1 被摘除
+var metricsInstanceHealth = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "discover_instance_health",
+		Help:      "discovered service instance health, 1 healthy, 0 probe failed, -1 ejected",
+	},
+	[]string{"service", "instance"},
+)
+
+// metricsInstanceEjections metrics for service instance ejections 计数器（Counter）
+var metricsInstanceEjections = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "discover_instance_ejections_total",
+		Help:      "service instance ejected by outlier detection total",
+	},
+	[]string{"service", "instance"},
+)
+
+func init() {
+	prometheus.MustRegister(metricsInstanceHealth, metricsInstanceEjections)
+}
+
+// RecordInstanceHealth 记录服务实例的健康状态
+func RecordInstanceHealth(service, instance string, health int) {
+	metricsInstanceHealth.With(prometheus.Labels{
+		"service":  service,
+		"instance": instance,
+	}).Set(float64(health))
+}
+
+// RecordInstanceEjection 记录服务实例被摘除
+func RecordInstanceEjection(service, instance string) {
+	metricsInstanceEjections.With(prometheus.Labels{
+		"service":  service,
+		"instance": instance,
+	}).Inc()
+}
+
+// DeleteInstanceHealth 服务实例下线后删除对应的指标
+func DeleteInstanceHealth(service, instance string) {
+	metricsInstanceHealth.Delete(prometheus.Labels{
+		"service":  service,
+		"instance": instance,
+	})
+}
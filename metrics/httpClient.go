@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsClientRequestsTotal metrics for outbound request total 计数器（Counter）
+var metricsClientRequestsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "client_requests_total",
+		Help:      "outbound http request total",
+	},
+	[]string{"host", "method", "path", "status_class"},
+)
+
+// metricsClientRequestsCost metrics for outbound requests cost 累积直方图（Histogram）
+var metricsClientRequestsCost = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "client_requests_cost",
+		Help:      "outbound http request cost seconds",
+	},
+	[]string{"host", "method", "path", "status_class"},
+)
+
+// metricsClientRequestsInFlight metrics for outbound requests in flight 仪表盘（Gauge）
+var metricsClientRequestsInFlight = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "client_requests_in_flight",
+		Help:      "outbound http requests in flight",
+	},
+	[]string{"host", "method"},
+)
+
+func init() {
+	prometheus.MustRegister(metricsClientRequestsTotal, metricsClientRequestsCost, metricsClientRequestsInFlight)
+}
+
+// RecordClientMetrics 记录对外请求的次数和耗时, path 需要是归一化之后的路径模板
+func RecordClientMetrics(host, method, path, statusClass string, costSeconds float64) {
+	labels := prometheus.Labels{
+		"host":         host,
+		"method":       method,
+		"path":         path,
+		"status_class": statusClass,
+	}
+	metricsClientRequestsTotal.With(labels).Inc()
+	metricsClientRequestsCost.With(labels).Observe(costSeconds)
+}
+
+// ClientInFlight 对外请求开始时调用, 返回的函数在请求结束时调用
+func ClientInFlight(host, method string) (done func()) {
+	gauge := metricsClientRequestsInFlight.With(prometheus.Labels{
+		"host":   host,
+		"method": method,
+	})
+	gauge.Inc()
+	return gauge.Dec
+}
@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsMirrorTotal metrics for mirrored request compare result 计数器（Counter）
+var metricsMirrorTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "mirror_requests_total",
+		Help:      "mirrored request total by compare result",
+	},
+	[]string{"service", "target", "result"},
+)
+
+func init() {
+	prometheus.MustRegister(metricsMirrorTotal)
+}
+
+// RecordMirror 记录一次镜像请求的对比结果, target 为镜像的版本或标签, result 如 match, status_diff, code_diff, body_diff, error, dropped
+func RecordMirror(service, target, result string) {
+	metricsMirrorTotal.With(prometheus.Labels{
+		"service": service,
+		"target":  target,
+		"result":  result,
+	}).Inc()
+}
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cast"
+)
+
+// metricsMongoCommandsCost metrics for mongo commands cost 累积直方图（Histogram）
+var metricsMongoCommandsCost = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "mongo_commands_cost",
+		Help:      "mongo command cost seconds",
+	},
+	[]string{"database", "collection", "command", "success"},
+)
+
+func init() {
+	prometheus.MustRegister(metricsMongoCommandsCost)
+}
+
+// RecordMongoMetrics 记录 mongo 命令的耗时指标
+func RecordMongoMetrics(database, collection, command string, success bool, costSeconds float64) {
+	metricsMongoCommandsCost.With(prometheus.Labels{
+		"database":   database,
+		"collection": collection,
+		"command":    command,
+		"success":    cast.ToString(success),
+	}).Observe(costSeconds)
+}
@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cast"
+)
+
+// metricsSQLQueriesCost metrics for sql queries cost 累积直方图（Histogram）
+var metricsSQLQueriesCost = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "sql_queries_cost",
+		Help:      "sql query cost seconds",
+	},
+	[]string{"db", "operation", "table", "success"},
+)
+
+func init() {
+	prometheus.MustRegister(metricsSQLQueriesCost)
+}
+
+// RecordSQLMetrics 记录 SQL 执行的耗时指标
+func RecordSQLMetrics(db, operation, table string, success bool, costSeconds float64) {
+	metricsSQLQueriesCost.With(prometheus.Labels{
+		"db":        db,
+		"operation": operation,
+		"table":     table,
+		"success":   cast.ToString(success),
+	}).Observe(costSeconds)
+}
+
+// dbStatsCollector 在每次采集时读取连接池状态 sql.DBStats
+type dbStatsCollector struct {
+	stats func() sql.DBStats
+
+	maxOpen           *prometheus.Desc
+	open              *prometheus.Desc
+	inUse             *prometheus.Desc
+	idle              *prometheus.Desc
+	waitCount         *prometheus.Desc
+	waitDuration      *prometheus.Desc
+	maxIdleClosed     *prometheus.Desc
+	maxIdleTimeClosed *prometheus.Desc
+	maxLifetimeClosed *prometheus.Desc
+}
+
+func newDBStatsCollector(db string, stats func() sql.DBStats) *dbStatsCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "sql_pool_"+name),
+			help,
+			nil,
+			prometheus.Labels{"db": db},
+		)
+	}
+	return &dbStatsCollector{
+		stats:             stats,
+		maxOpen:           desc("max_open", "maximum number of open connections to the database"),
+		open:              desc("open", "the number of established connections both in use and idle"),
+		inUse:             desc("in_use", "the number of connections currently in use"),
+		idle:              desc("idle", "the number of idle connections"),
+		waitCount:         desc("wait_count_total", "the total number of connections waited for"),
+		waitDuration:      desc("wait_seconds_total", "the total time blocked waiting for a new connection"),
+		maxIdleClosed:     desc("max_idle_closed_total", "the total number of connections closed due to SetMaxIdleConns"),
+		maxIdleTimeClosed: desc("max_idle_time_closed_total", "the total number of connections closed due to SetConnMaxIdleTime"),
+		maxLifetimeClosed: desc("max_lifetime_closed_total", "the total number of connections closed due to SetConnMaxLifetime"),
+	}
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpen
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.maxIdleClosed
+	ch <- c.maxIdleTimeClosed
+	ch <- c.maxLifetimeClosed
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stats()
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(s.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(s.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(s.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(s.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, s.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.maxIdleClosed, prometheus.CounterValue, float64(s.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(c.maxIdleTimeClosed, prometheus.CounterValue, float64(s.MaxIdleTimeClosed))
+	ch <- prometheus.MustNewConstMetric(c.maxLifetimeClosed, prometheus.CounterValue, float64(s.MaxLifetimeClosed))
+}
+
+// RegisterDBStats 注册数据库连接池指标, 同一个 db 名称只会注册一次
+func RegisterDBStats(db string, stats func() sql.DBStats) error {
+	err := prometheus.Register(newDBStatsCollector(db, stats))
+	if err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			return nil
+		}
+	}
+	return err
+}